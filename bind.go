@@ -0,0 +1,265 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Flag annotations that override where parse() looks for a flag's value.
+const (
+	envAnnotation    = "start_env"    // name of the environment variable
+	configAnnotation = "start_config" // dotted key in the config file
+)
+
+// BindFlags registers a flag for each exported field of the struct that opts
+// points to. The field then receives the value of the flag, which start
+// populates from the command line, the environment, the config file, or the
+// default value, like any other flag.
+// Struct tags control the details:
+//
+//	type Options struct {
+//		Voice string `flag:"voice,v" env:"VOICE" default:"Homer" usage:"The voice used for text-to-speech" config:"translate.voice"`
+//		Speak bool   `flag:"speak,p" usage:"Speak out the translated string"`
+//	}
+//
+// "flag" is the flag name, optionally followed by a one-letter shorthand.
+// Without a "flag" tag, the flag name is the lower-case field name; "-"
+// skips the field.
+// "default" is the default value. Without a "default" tag, the current value
+// of the field becomes the default value.
+// "usage" is the help text.
+// "env" is the name of the environment variable that sets the flag, instead
+// of <PREFIX>_<FLAGNAME> (see SetEnvName()). "-" means that no environment
+// variable sets the flag.
+// "config" is the (dotted) key in the config file that sets the flag,
+// instead of the top-level key named like the flag.
+// "secret" set to "true" marks the flag as secret (see Secret()).
+// "prompt" set to "true" makes Parse() ask for missing values (see Prompt()).
+// "choices" is a comma-separated list of allowed values (see Choices()).
+// "group" is the section of the help output that lists the flag (see
+// FlagGroup()).
+// Supported field types are all types that pflag supports: strings, bools,
+// ints, uints, floats, time.Duration, net.IP, slices of strings, ints,
+// bools, floats, and durations, maps from strings to strings or ints, and
+// any type whose pointer implements pflag.Value.
+// BindFlags returns the names of the new flags. If a field is invalid,
+// BindFlags returns an error, registers none of the flags, and leaves the
+// struct unchanged.
+// Call it before Parse() or
+// Up(). To bind flags that only a specific command accepts, use the Options
+// field of Command instead.
+func BindFlags(opts interface{}) ([]string, error) {
+	rv := reflect.ValueOf(opts)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("BindFlags: opts must be a non-nil pointer to a struct, not " + fmt.Sprintf("%T", opts))
+	}
+	rv = rv.Elem()
+	t := rv.Type()
+	// Bind all fields to a separate flag set first, so that an invalid
+	// field leaves flag.CommandLine unchanged.
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	// Binding writes the default values into the fields. Keep a copy to
+	// undo this if a later field is invalid. A shallow copy suffices, as
+	// pflag's values replace slices and maps instead of modifying them.
+	orig := reflect.New(t).Elem()
+	orig.Set(rv)
+	var names []string
+	choices := map[string][]string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+		name, shorthand := parseFlagTag(field)
+		if name == "-" {
+			continue
+		}
+		err := bindFlag(fs, name, shorthand, field, rv.Field(i))
+		if err != nil {
+			rv.Set(orig)
+			return nil, errors.New("BindFlags: field " + field.Name + ": " + err.Error())
+		}
+		names = append(names, name)
+		if c := field.Tag.Get("choices"); len(c) > 0 {
+			choices[name] = strings.Split(c, ",")
+		}
+	}
+	for _, name := range names {
+		flag.CommandLine.AddFlag(fs.Lookup(name))
+	}
+	for _, name := range names {
+		if c, ok := choices[name]; ok {
+			if err := Choices(name, c...); err != nil {
+				return names, errors.New("BindFlags: " + err.Error())
+			}
+		}
+	}
+	return names, nil
+}
+
+// parseFlagTag returns the flag name and shorthand from the field's "flag" tag.
+func parseFlagTag(field reflect.StructField) (name, shorthand string) {
+	tag := field.Tag.Get("flag")
+	if len(tag) == 0 {
+		return strings.ToLower(field.Name), ""
+	}
+	parts := strings.SplitN(tag, ",", 2)
+	name = strings.TrimSpace(parts[0])
+	if len(parts) > 1 {
+		shorthand = strings.TrimSpace(parts[1])
+	}
+	return name, shorthand
+}
+
+// bindFlag registers the flag for a struct field in fs and applies the
+// field's tags.
+func bindFlag(fs *flag.FlagSet, name, shorthand string, field reflect.StructField, fv reflect.Value) error {
+	if flag.Lookup(name) != nil || fs.Lookup(name) != nil {
+		return errors.New("flag " + name + " already exists")
+	}
+	if len(shorthand) > 1 {
+		return errors.New("shorthand " + shorthand + " of flag " + name + " must be a single letter")
+	}
+	if len(shorthand) > 0 && (flag.ShorthandLookup(shorthand) != nil || fs.ShorthandLookup(shorthand) != nil) {
+		return errors.New("shorthand " + shorthand + " of flag " + name + " already exists")
+	}
+	usage := field.Tag.Get("usage")
+
+	switch p := fv.Addr().Interface().(type) {
+	case flag.Value:
+		fs.VarP(p, name, shorthand, usage)
+	case *string:
+		fs.StringVarP(p, name, shorthand, *p, usage)
+	case *bool:
+		fs.BoolVarP(p, name, shorthand, *p, usage)
+	case *int:
+		fs.IntVarP(p, name, shorthand, *p, usage)
+	case *int8:
+		fs.Int8VarP(p, name, shorthand, *p, usage)
+	case *int16:
+		fs.Int16VarP(p, name, shorthand, *p, usage)
+	case *int32:
+		fs.Int32VarP(p, name, shorthand, *p, usage)
+	case *time.Duration: // before *int64, as time.Duration is a distinct type
+		fs.DurationVarP(p, name, shorthand, *p, usage)
+	case *int64:
+		fs.Int64VarP(p, name, shorthand, *p, usage)
+	case *uint:
+		fs.UintVarP(p, name, shorthand, *p, usage)
+	case *uint8:
+		fs.Uint8VarP(p, name, shorthand, *p, usage)
+	case *uint16:
+		fs.Uint16VarP(p, name, shorthand, *p, usage)
+	case *uint32:
+		fs.Uint32VarP(p, name, shorthand, *p, usage)
+	case *uint64:
+		fs.Uint64VarP(p, name, shorthand, *p, usage)
+	case *float32:
+		fs.Float32VarP(p, name, shorthand, *p, usage)
+	case *float64:
+		fs.Float64VarP(p, name, shorthand, *p, usage)
+	case *net.IP:
+		fs.IPVarP(p, name, shorthand, *p, usage)
+	case *[]string:
+		fs.StringSliceVarP(p, name, shorthand, *p, usage)
+	case *[]int:
+		fs.IntSliceVarP(p, name, shorthand, *p, usage)
+	case *[]bool:
+		fs.BoolSliceVarP(p, name, shorthand, *p, usage)
+	case *[]float64:
+		fs.Float64SliceVarP(p, name, shorthand, *p, usage)
+	case *[]time.Duration:
+		fs.DurationSliceVarP(p, name, shorthand, *p, usage)
+	case *map[string]string:
+		fs.StringToStringVarP(p, name, shorthand, *p, usage)
+	case *map[string]int:
+		fs.StringToIntVarP(p, name, shorthand, *p, usage)
+	default:
+		return errors.New("unsupported type " + field.Type.String())
+	}
+
+	f := fs.Lookup(name)
+	if def, ok := field.Tag.Lookup("default"); ok {
+		err := setDefault(f, def)
+		if err != nil {
+			return errors.New("invalid default value " + def + ": " + err.Error())
+		}
+	}
+	if env := field.Tag.Get("env"); len(env) > 0 {
+		if env == "-" {
+			env = ""
+		}
+		fs.SetAnnotation(name, envAnnotation, []string{env})
+	}
+	if key := field.Tag.Get("config"); len(key) > 0 {
+		fs.SetAnnotation(name, configAnnotation, []string{key})
+	}
+	if field.Tag.Get("secret") == "true" {
+		fs.SetAnnotation(name, secretAnnotation, []string{"true"})
+	}
+	if field.Tag.Get("prompt") == "true" {
+		fs.SetAnnotation(name, promptAnnotation, []string{"true"})
+	}
+	if group := field.Tag.Get("group"); len(group) > 0 {
+		fs.SetAnnotation(name, groupAnnotation, []string{group})
+	}
+	return nil
+}
+
+// setDefault sets the flag to its default value def.
+// Slice values get replaced, as Set() would make the next call to Set()
+// append to the default value rather than replacing it.
+func setDefault(f *flag.Flag, def string) error {
+	var err error
+	if sv, ok := f.Value.(flag.SliceValue); ok {
+		var vals []string
+		if len(def) > 0 {
+			vals = strings.Split(def, ",")
+		}
+		err = sv.Replace(vals)
+	} else {
+		err = f.Value.Set(def)
+	}
+	if err != nil {
+		return err
+	}
+	f.DefValue = f.Value.String()
+	return nil
+}
+
+// bindOptions binds the flags for the command's Options struct, if any,
+// and adds them to the command's flags. Binding happens only once per command.
+func (cmd *Command) bindOptions() error {
+	if cmd.Options == nil || cmd.optionsBound {
+		return nil
+	}
+	names, err := BindFlags(cmd.Options)
+	if err != nil {
+		return errors.New("Add: command " + cmd.Name + ": " + err.Error())
+	}
+	cmd.Flags = append(cmd.Flags, names...)
+	cmd.optionsBound = true
+	return nil
+}
+
+// configKey returns the config file key for flag f: the key from the flag's
+// config annotation, if any, or the flag name.
+func configKey(f *flag.Flag) string {
+	if key, ok := f.Annotations[configAnnotation]; ok && len(key) > 0 {
+		return key[0]
+	}
+	return f.Name
+}
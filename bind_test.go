@@ -0,0 +1,180 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+type translateOptions struct {
+	Voice   string            `flag:"voice,v" env:"VOICE" default:"Homer" usage:"The voice used for text-to-speech" config:"translate.voice"`
+	Speak   bool              `flag:"speak,p" usage:"Speak out the translated string"`
+	Rate    int               `default:"3"`
+	Pause   time.Duration     `flag:"pause" default:"1s"`
+	Langs   []string          `flag:"langs" default:"en,de"`
+	Aliases map[string]string `flag:"aliases"`
+	Skipped string            `flag:"-"`
+	hidden  string
+}
+
+func TestBindFlags(t *testing.T) {
+	Convey("Given a struct with flag tags", t, func() {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		Commands = CommandMap{}
+		privateFlags = privateFlagsMap{}
+		os.Args = []string{os.Args[0]}
+		SetFileSystem(fstest.MapFS{})
+		env := map[string]string{}
+		SetEnvLookup(mapEnv(env))
+		var opts translateOptions
+
+		Convey("BindFlags should register a flag for each field", func() {
+			names, err := BindFlags(&opts)
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"voice", "speak", "rate", "pause", "langs", "aliases"})
+			voice := flag.Lookup("voice")
+			So(voice.Shorthand, ShouldEqual, "v")
+			So(voice.Usage, ShouldEqual, "The voice used for text-to-speech")
+			So(voice.DefValue, ShouldEqual, "Homer")
+			So(flag.Lookup("skipped"), ShouldBeNil)
+			So(flag.Lookup("hidden"), ShouldBeNil)
+
+			Convey("and set the defaults", func() {
+				So(Reparse(), ShouldBeNil)
+				So(opts.Voice, ShouldEqual, "Homer")
+				So(opts.Rate, ShouldEqual, 3)
+				So(opts.Pause, ShouldEqual, time.Second)
+				So(opts.Langs, ShouldResemble, []string{"en", "de"})
+			})
+
+			Convey("and populate the struct from the config file", func() {
+				SetFileSystem(fstest.MapFS{
+					"start.toml": {Data: []byte("voice = \"ignored\"\nrate = 5\n[translate]\nvoice = \"Marge\"")},
+				})
+				So(Reparse(), ShouldBeNil)
+				So(opts.Voice, ShouldEqual, "Marge")
+				So(opts.Rate, ShouldEqual, 5)
+
+				Convey("from the environment variable given in the tag", func() {
+					env["VOICE"] = "Bart"
+					env["START_VOICE"] = "ignored"
+					So(Reparse(), ShouldBeNil)
+					So(opts.Voice, ShouldEqual, "Bart")
+
+					Convey("and from the command line", func() {
+						os.Args = []string{os.Args[0], "-v", "Lisa", "--speak", "--aliases", "a=b"}
+						So(Reparse(), ShouldBeNil)
+						So(opts.Voice, ShouldEqual, "Lisa")
+						So(opts.Speak, ShouldBeTrue)
+						So(opts.Aliases, ShouldResemble, map[string]string{"a": "b"})
+					})
+				})
+			})
+
+			Convey("Binding the same flags again should fail", func() {
+				var again translateOptions
+				_, err := BindFlags(&again)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("BindFlags should reject unsupported types", func() {
+			var bad struct{ Ch chan int }
+			_, err := BindFlags(&bad)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "chan int")
+		})
+
+		Convey("BindFlags should only accept pointers to structs", func() {
+			_, err := BindFlags(opts)
+			So(err, ShouldNotBeNil)
+			_, err = BindFlags(nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("An invalid field should leave all flags unregistered", func() {
+			var bad struct {
+				First  string
+				Second int `default:"many"`
+			}
+			_, err := BindFlags(&bad)
+			So(err, ShouldNotBeNil)
+			So(flag.Lookup("first"), ShouldBeNil)
+			So(flag.Lookup("second"), ShouldBeNil)
+		})
+
+		Convey("An invalid field should leave the struct unchanged", func() {
+			bad := struct {
+				Name   string            `default:"Joe"`
+				Tags   []string          `default:"a,b"`
+				Labels map[string]string `default:"k=v"`
+				Count  int               `default:"many"`
+			}{Name: "Jane", Tags: []string{"x"}, Labels: map[string]string{"l": "1"}}
+			_, err := BindFlags(&bad)
+			So(err, ShouldNotBeNil)
+			So(bad.Name, ShouldEqual, "Jane")
+			So(bad.Tags, ShouldResemble, []string{"x"})
+			So(bad.Labels, ShouldResemble, map[string]string{"l": "1"})
+			So(bad.Count, ShouldEqual, 0)
+		})
+
+		Convey("The choices tag should restrict the values", func() {
+			var c struct {
+				Color string `choices:"red,green"`
+			}
+			_, err := BindFlags(&c)
+			So(err, ShouldBeNil)
+			So(flag.Lookup("color").Annotations[choicesAnnotation], ShouldResemble, []string{"red", "green"})
+			os.Args = []string{os.Args[0], "--color=blue"}
+			err = Reparse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "must be one of red, green")
+		})
+
+		Convey("A duplicate flag name within the struct should be an error", func() {
+			var dup struct {
+				A string `flag:"same"`
+				B string `flag:"same"`
+			}
+			_, err := BindFlags(&dup)
+			So(err, ShouldNotBeNil)
+			So(flag.Lookup("same"), ShouldBeNil)
+		})
+
+		Convey("A command with Options should accept the bound flags only for itself", func() {
+			So(Add(&Command{Name: "translate", Options: &opts, Cmd: func(*Command) error { return nil }}), ShouldBeNil)
+			So(Add(&Command{Name: "check", Cmd: func(*Command) error { return nil }}), ShouldBeNil)
+			So(Commands["translate"].Flags, ShouldContain, "voice")
+
+			os.Args = []string{os.Args[0], "translate", "--voice", "Maggie"}
+			So(Reparse(), ShouldBeNil)
+			cmd, err := readCommand(flag.Args())
+			So(err, ShouldBeNil)
+			So(cmd.Name, ShouldEqual, "translate")
+			So(opts.Voice, ShouldEqual, "Maggie")
+
+			os.Args = []string{os.Args[0], "check", "--voice", "Maggie"}
+			So(Reparse(), ShouldBeNil)
+			_, err = readCommand(flag.Args())
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			Commands = CommandMap{}
+			privateFlags = privateFlagsMap{}
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+		})
+	})
+}
@@ -8,8 +8,10 @@
 package start
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -29,6 +31,9 @@ func (c *CommandMap) Add(cmd *Command) error {
 	if cmd == nil {
 		return errors.New("Add: Parameter cmd must not be nil.")
 	}
+	if err := cmd.bindOptions(); err != nil {
+		return err
+	}
 	cmd.init()
 	if cmd.Parent == "" {
 		// Add a top-level command.
@@ -36,6 +41,7 @@ func (c *CommandMap) Add(cmd *Command) error {
 			return errors.New("Add: command " + cmd.Name + " already exists.")
 		}
 		(*c)[cmd.Name] = cmd
+		cmd.countCommand()
 		return nil
 	}
 	// Add a child command. Parent can be a path like "newsletter template".
@@ -50,6 +56,9 @@ func (c *CommandMap) Add(cmd *Command) error {
 
 // Add for Command adds a subcommand to a command.
 func (cmd *Command) Add(subcmd *Command) error {
+	if err := subcmd.bindOptions(); err != nil {
+		return err
+	}
 	cmd.init()
 	subcmd.init()
 	if _, alreadyExists := (*cmd).children[subcmd.Name]; alreadyExists {
@@ -57,18 +66,107 @@ func (cmd *Command) Add(subcmd *Command) error {
 			" already exists for command " + cmd.Name + ".")
 	}
 	(*cmd).children[subcmd.Name] = subcmd
+	subcmd.countCommand()
 	return nil
 }
 
-// Helper functions for External() and Usage():
-// errPrintln & errPrintf -> print to stderr
+// Context returns the context that Up() passed to the command.
+// The context is cancelled when the application receives SIGINT or SIGTERM.
+// Commands that use Cmd instead of RunE can call Context() to get notified
+// about the shutdown request. If a Cmd function has not called Context()
+// when the first signal arrives, the application exits immediately, as the
+// command cannot react to the cancellation.
+func (cmd *Command) Context() context.Context {
+	cmd.ctxRequested.Store(true)
+	if cmd.ctx == nil {
+		return context.Background()
+	}
+	return cmd.ctx
+}
 
-func errPrintln(args ...interface{}) {
-	fmt.Fprintln(os.Stderr, args...)
+// handlesSignals returns true if cmd can react to the cancellation of its
+// context: it uses RunE, or it has called Context().
+func (cmd *Command) handlesSignals() bool {
+	return cmd.RunE != nil || cmd.ctxRequested.Load()
+}
+
+// runnable returns true if the command has a function to execute.
+func (cmd *Command) runnable() bool {
+	return cmd.RunE != nil || cmd.Cmd != nil
+}
+
+// run executes the command with the given context. RunE takes precedence
+// over Cmd.
+func (cmd *Command) run(ctx context.Context) error {
+	cmd.ctx = ctx
+	if cmd.RunE != nil {
+		return cmd.RunE(ctx, cmd)
+	}
+	if cmd.Cmd != nil {
+		return cmd.Cmd(cmd)
+	}
+	return errors.New("Command " + cmd.Name + " has nothing to execute")
 }
 
-func errPrintf(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, format, args...)
+// execute runs the command together with its pre-run and post-run hooks.
+func (cmd *Command) execute(ctx context.Context) error {
+	cmd.ctx = ctx
+	if c := cmd.persistentHookOwner(func(c *Command) bool { return c.PersistentPreRun != nil }); c != nil {
+		if err := c.PersistentPreRun(cmd); err != nil {
+			return err
+		}
+	}
+	if cmd.PreRun != nil {
+		if err := cmd.PreRun(cmd); err != nil {
+			return err
+		}
+	}
+	if err := chain(runCmd)(ctx, cmd); err != nil {
+		return err
+	}
+	if cmd.PostRun != nil {
+		if err := cmd.PostRun(cmd); err != nil {
+			return err
+		}
+	}
+	if c := cmd.persistentHookOwner(func(c *Command) bool { return c.PersistentPostRun != nil }); c != nil {
+		return c.PersistentPostRun(cmd)
+	}
+	return nil
+}
+
+// persistentHookOwner walks up from cmd to the top-level command and returns
+// the first command for which hasHook returns true, or nil if there is none.
+func (cmd *Command) persistentHookOwner(hasHook func(c *Command) bool) *Command {
+	for c := cmd; c != nil; c = c.parent() {
+		if hasHook(c) {
+			return c
+		}
+	}
+	return nil
+}
+
+// parent returns the parent command, or nil for top-level commands.
+func (cmd *Command) parent() *Command {
+	if cmd.Parent == "" {
+		return nil
+	}
+	p, err := findCommand(strings.Split(cmd.Parent, " "))
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// runCmd is the innermost CmdFunc of the middleware chain.
+func runCmd(ctx context.Context, cmd *Command) error {
+	return cmd.run(ctx)
+}
+
+// errPrintln prints messages of the library to the default stderr stream
+// (see SetStreams()).
+func errPrintln(args ...interface{}) {
+	fmt.Fprintln(defaultStderr(), args...)
 }
 
 // External defines an external command to execute via os/exec. The external command's name follows Git subcommmand naming convention: "mycmd do" invokes the external command "mycmd-do".
@@ -77,14 +175,15 @@ func External() func(cmd *Command) error {
 		cmdName := appName() + "-" + cmd.Name
 		path := filepath.Join(cmd.Path, cmdName)
 		c := exec.Command(path, rawCmdArgs)
+		c.Stdin = cmd.stdin()
 		out, err := c.Output()
-		fmt.Println(string(out))
+		fmt.Fprintln(cmd.stdout(), string(out))
 		if err != nil {
 			exitErr, ok := err.(*exec.ExitError)
 			if ok {
-				errPrintln(string(exitErr.Stderr))
+				fmt.Fprintln(cmd.stderr(), string(exitErr.Stderr))
 			} else {
-				errPrintln(err)
+				fmt.Fprintln(cmd.stderr(), err)
 			}
 		}
 
@@ -99,50 +198,51 @@ func External() func(cmd *Command) error {
 // subcommands.
 // Parse() or Up() must be called before invoking Usage().
 func Usage(cmd *Command) error {
+	w := cmd.stderr()
 	if cmd == nil {
-		applicationUsage()
+		applicationUsage(w)
 	} else {
-		err := commandUsage(cmd)
+		err := commandUsage(w, cmd)
 		if err != nil {
-			errPrintln(err)
+			fmt.Fprintln(w, err)
 		}
 	}
-	errPrintln()
+	fmt.Fprintln(w)
 	return nil
 }
 
-func applicationUsage() {
-	errPrintln()
-	errPrintln(filepath.Base(os.Args[0]))
-	errPrintln()
+func applicationUsage(w io.Writer) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, displayName())
+	fmt.Fprintln(w)
 	if len(description) > 0 {
-		errPrintln(description)
-		errPrintln()
+		fmt.Fprintln(w, description)
+		fmt.Fprintln(w)
 	}
 	if len(Commands) > 0 {
-		width := maxCmdNameLen()
-		errPrintln("Available commands:")
-		errPrintln()
-		names := make([]string, 0, len(Commands))
-		for name := range Commands {
-			names = append(names, name)
-		}
-		sort.Strings(names)
-		for _, name := range names {
-			c := Commands[name]
-			errPrintf("%-*s  %s\n", width, c.Name, c.Short)
+		cmds := make([]*Command, 0, len(Commands))
+		for _, c := range Commands {
+			cmds = append(cmds, c)
 		}
+		commandListUsage(w, "Available commands:", cmds)
 	}
 	globalFlagNames := getGlobalFlagNames()
 	if len(globalFlagNames) > 0 {
-		errPrintln()
-		errPrintln("Available global flags:")
-		errPrintln()
-		flagUsage(globalFlagNames)
-	}
-	configFileUsage()
-	errPrintln("Type ag help <command> to get help for a specific command.")
-	errPrintln()
+		fmt.Fprintln(w)
+		flagListUsage(w, "Available global flags:", globalFlagNames)
+	}
+	configFileUsage(w)
+	fmt.Fprintln(w, "Type "+displayName()+" help <command> to get help for a specific command.")
+	fmt.Fprintln(w)
+}
+
+// displayName returns the application name for the help output: the name
+// set via SetAppName(), or the name of the executable.
+func displayName() string {
+	if customAppName {
+		return App
+	}
+	return filepath.Base(os.Args[0])
 }
 
 func getGlobalFlagNames() []string {
@@ -156,52 +256,32 @@ func getGlobalFlagNames() []string {
 	return globalFlags
 }
 
-func commandUsage(cmd *Command) error {
-	errPrintln()
+func commandUsage(w io.Writer, cmd *Command) error {
+	fmt.Fprintln(w)
 	if cmd.Parent != "" {
-		errPrintf("%v ", cmd.Parent)
+		fmt.Fprintf(w, "%v ", cmd.Parent)
 	}
-	errPrintf("%v\n\n%v\n", cmd.Name, cmd.Long)
+	fmt.Fprintf(w, "%v\n\n%v\n", cmd.Name, cmd.Long)
 	if len(cmd.Flags) > 0 {
 		if err := Parse(); err != nil {
 			return err
 		}
-		errPrintln()
-		errPrintln("Command-specific flags:")
-		errPrintln()
-		flagUsage(cmd.Flags)
+		fmt.Fprintln(w)
+		flagListUsage(w, "Command-specific flags:", cmd.Flags)
 	}
 	cmd.init()
 	if len(cmd.children) > 0 {
-		errPrintln()
-		errPrintln("Available subcommands:")
-		errPrintln()
-		width := maxSubcmdNameLen(cmd)
-		names := make([]string, 0, len(cmd.children))
-		for name := range cmd.children {
-			names = append(names, name)
-		}
-		sort.Strings(names)
-		for _, name := range names {
-			subcmd := cmd.children[name]
-			errPrintf("%-*s  %s\n", width, subcmd.Name, subcmd.Short)
+		fmt.Fprintln(w)
+		subcmds := make([]*Command, 0, len(cmd.children))
+		for _, subcmd := range cmd.children {
+			subcmds = append(subcmds, subcmd)
 		}
+		commandListUsage(w, "Available subcommands:", subcmds)
 	}
 	return nil
 }
 
-func maxSubcmdNameLen(cmd *Command) int {
-	maxLength := 0
-	for _, subcmd := range cmd.children {
-		length := len(subcmd.Name)
-		if length > maxLength {
-			maxLength = length
-		}
-	}
-	return maxLength
-}
-
-func flagUsage(flagNames []string) {
+func flagUsage(w io.Writer, flagNames []string) {
 	flagUsageList := [][]string{}
 	var flagNamesAndDefault string
 	var width int
@@ -210,38 +290,46 @@ func flagUsage(flagNames []string) {
 		if flg == nil {
 			panic("Flag '" + flagName + "' does not exist.")
 		}
-		flagNamesAndDefault = fmt.Sprintf("-%s, --%s=%s", flg.Shorthand, flagName, flg.Value) // TODO -> pflag specific "Shorthand"
+		if len(flg.Shorthand) > 0 {
+			flagNamesAndDefault = fmt.Sprintf("-%s, --%s=%s", flg.Shorthand, flagName, displayValue(flg)) // TODO -> pflag specific "Shorthand"
+		} else {
+			flagNamesAndDefault = fmt.Sprintf("    --%s=%s", flagName, displayValue(flg))
+		}
 		if width < len(flagNamesAndDefault) {
 			width = len(flagNamesAndDefault)
 		}
-		flagUsageList = append(flagUsageList, []string{flagNamesAndDefault, flg.Usage})
+		usage := flg.Usage
+		if env := envVarName(flg); len(env) > 0 {
+			usage += " [$" + env + "]"
+		}
+		flagUsageList = append(flagUsageList, []string{flagNamesAndDefault, usage})
 	}
 	for _, flg := range flagUsageList {
-		errPrintf("%-*s  %s\n", width, flg[0], flg[1])
+		fmt.Fprintf(w, "%-*s  %s\n", width, flg[0], flg[1])
 	}
 }
 
-func configFileUsage() {
+func configFileUsage(w io.Writer) {
 	cfg := ConfigFilePath()
-	errPrintln()
+	fmt.Fprintln(w)
 	if len(cfg) > 0 {
-		errPrintf("Config file: %s\n", cfg)
+		fmt.Fprintf(w, "Config file: %s\n", cfg)
 	} else {
-		errPrintln("No config file.")
+		fmt.Fprintln(w, "No config file.")
 	}
-	errPrintln()
+	fmt.Fprintln(w)
 }
 
 func help(cmd *Command) error {
 	if len(cmd.Args) == 0 {
-		applicationUsage()
+		applicationUsage(cmd.stderr())
 		return nil
 	}
 	command, err := findCommand(cmd.Args)
 	if err != nil {
 		return err
 	}
-	return commandUsage(command)
+	return commandUsage(cmd.stderr(), command)
 }
 
 func findCommand(args []string) (*Command, error) {
@@ -267,22 +355,10 @@ func findCommand(args []string) (*Command, error) {
 }
 
 func showVersion(cmd *Command) error {
-	errPrintln(filepath.Base(os.Args[0]) + " version " + version)
+	fmt.Fprintln(cmd.stderr(), displayName()+" version "+version)
 	return nil
 }
 
-// maxCmdNameLen returns the length of the longest command name.
-func maxCmdNameLen() int {
-	maxLength := 0
-	for _, cmd := range Commands {
-		length := len(cmd.Name)
-		if length > maxLength {
-			maxLength = length
-		}
-	}
-	return maxLength
-}
-
 // init initializes the children map.
 // Calling init more than once for the same cmd should be safe.
 func (cmd *Command) init() *Command {
@@ -362,9 +438,10 @@ func readCommand(args []string) (*Command, error) {
 	if len(args) == 0 {
 		// Subcommands exist but none was not found in args.
 		// If no main cmd is defined, return an error.
-		if cmd.Cmd == nil {
+		if !cmd.runnable() {
 			return wrongOrMissingSubcommand(cmd)
 		}
+		return cmdWithFlagsChecked(cmd, args)
 	}
 
 	// len (cmd.children > 0) && len(args) > 0
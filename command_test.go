@@ -8,6 +8,8 @@
 package start
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
@@ -527,6 +529,71 @@ func TestHelpOutput(t *testing.T) {
 	})
 }
 
+func TestHooks(t *testing.T) {
+	var calls []string
+	record := func(name string) func(cmd *Command) error {
+		return func(cmd *Command) error {
+			calls = append(calls, name+":"+cmd.Name)
+			return nil
+		}
+	}
+
+	Commands = make(CommandMap)
+
+	Convey("Given a command tree with hooks", t, func() {
+		calls = nil
+		Add(&Command{
+			Name:              "db",
+			PersistentPreRun:  record("db.persistentpre"),
+			PersistentPostRun: record("db.persistentpost"),
+		})
+		Add(&Command{
+			Parent:  "db",
+			Name:    "migrate",
+			PreRun:  record("migrate.pre"),
+			PostRun: record("migrate.post"),
+			Cmd:     record("migrate"),
+		})
+		Add(&Command{
+			Parent:           "db",
+			Name:             "dump",
+			PersistentPreRun: record("dump.persistentpre"),
+			Cmd: func(cmd *Command) error {
+				calls = append(calls, "dump:"+cmd.Name)
+				return errors.New("dump failed")
+			},
+			PostRun: record("dump.post"),
+		})
+
+		Convey("a subcommand should run the inherited persistent hooks around its own hooks", func() {
+			err := Commands["db"].children["migrate"].execute(context.Background())
+			So(err, ShouldBeNil)
+			So(calls, ShouldResemble, []string{
+				"db.persistentpre:migrate",
+				"migrate.pre:migrate",
+				"migrate:migrate",
+				"migrate.post:migrate",
+				"db.persistentpost:migrate",
+			})
+		})
+
+		Convey("a subcommand's own persistent hook should override the parent's one", func() {
+			Commands["db"].children["dump"].execute(context.Background())
+			So(calls[0], ShouldEqual, "dump.persistentpre:dump")
+		})
+
+		Convey("post-run hooks should not run if the command fails", func() {
+			err := Commands["db"].children["dump"].execute(context.Background())
+			So(err, ShouldNotBeNil)
+			So(calls, ShouldResemble, []string{"dump.persistentpre:dump", "dump:dump"})
+		})
+
+		Reset(func() {
+			Commands = make(CommandMap)
+		})
+	})
+}
+
 func captureStderr(f func()) string {
 	old := os.Stderr
 	r, w, _ := os.Pipe()
@@ -630,11 +697,14 @@ func Example_helpNoArgs() {
 	//
 	// Available global flags:
 	//
-	// -v, --verbose=false  Enable verbose output
+	//     --config=          Read the config file from this path
+	//     --no-config=false  Do not read any config file
+	//     --profile=         Use the settings from the config file section [profile.<name>] [$START_PROFILE]
+	// -v, --verbose=false    Enable verbose output [$START_VERBOSE]
 	//
 	// No config file.
 	//
-	// Type ag help <command> to get help for a specific command.
+	// Type start.test help <command> to get help for a specific command.
 }
 
 func Example_helpCommand() {
@@ -695,7 +765,7 @@ func Example_helpCommand() {
 	//
 	// Command-specific flags:
 	//
-	// -f, --format=text  Output format (text, json)
+	// -f, --format=text  Output format (text, json) [$START_FORMAT]
 	//
 	// Available subcommands:
 	//
@@ -760,7 +830,7 @@ func Example_helpSubcommand() {
 	//
 	// Command-specific flags:
 	//
-	// -v, --verbose=false  Enable verbose output
+	// -v, --verbose=false  Enable verbose output [$START_VERBOSE]
 	//
 	// Available subcommands:
 	//
@@ -0,0 +1,166 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// The global flags --config, --no-config, and --profile select the config
+// file and the profile from the command line. Unlike all other flags, they
+// must be known before the config file is read, so parse() pre-parses them
+// from the raw arguments. They do not get values from the config
+// file. Only the profile can also be set through the environment variable
+// <APPNAME>_PROFILE.
+
+const (
+	configFlagName   = "config"
+	noConfigFlagName = "no-config"
+	profileFlagName  = "profile"
+)
+
+var (
+	configFlagValue   string
+	noConfigFlagValue bool
+	profileFlagValue  string
+	// configFlags are the flags registered by registerConfigFlags().
+	// If the application defines its own flag with one of these names,
+	// start leaves that flag alone.
+	configFlags = map[string]*flag.Flag{}
+)
+
+// configArgs contains the pre-parsed values of the config flags.
+type configArgs struct {
+	path     string
+	noConfig bool
+	profile  string
+}
+
+// registerConfigFlags adds --config, --no-config, and --profile to the
+// global flags, unless the application has defined flags of these names.
+func registerConfigFlags() {
+	if flag.Lookup(configFlagName) == nil {
+		flag.StringVar(&configFlagValue, configFlagName, "", "Read the config file from this path")
+		configFlags[configFlagName] = flag.Lookup(configFlagName)
+	}
+	if flag.Lookup(noConfigFlagName) == nil {
+		flag.BoolVar(&noConfigFlagValue, noConfigFlagName, false, "Do not read any config file")
+		configFlags[noConfigFlagName] = flag.Lookup(noConfigFlagName)
+	}
+	if flag.Lookup(profileFlagName) == nil {
+		flag.StringVar(&profileFlagValue, profileFlagName, "", "Use the settings from the config file section [profile.<name>]")
+		configFlags[profileFlagName] = flag.Lookup(profileFlagName)
+	}
+}
+
+// isConfigFlag returns true if f is one of the flags added by
+// registerConfigFlags().
+func isConfigFlag(f *flag.Flag) bool {
+	return f != nil && configFlags[f.Name] == f
+}
+
+// preParseConfigFlags scans the arguments for the config flags.
+func preParseConfigFlags(args []string) (configArgs, error) {
+	var ca configArgs
+	var err error
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		name, value := arg[2:], ""
+		hasValue := false
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, value, hasValue = name[:eq], name[eq+1:], true
+		}
+		if !isConfigFlag(flag.Lookup(name)) {
+			continue
+		}
+		if name == noConfigFlagName {
+			ca.noConfig = true
+			if hasValue {
+				ca.noConfig, err = strconv.ParseBool(value)
+				if err != nil {
+					return ca, errors.New("invalid value for --" + noConfigFlagName + ": " + value)
+				}
+			}
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return ca, errors.New("flag needs an argument: --" + name)
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case configFlagName:
+			ca.path = value
+		case profileFlagName:
+			ca.profile = value
+		}
+	}
+	return ca, nil
+}
+
+// readConfigFile reads the config file as determined by --config,
+// --no-config, or SetConfigFile(), and selects the profile as determined by
+// --profile or <APPNAME>_PROFILE. It pre-parses the config flags from args.
+func readConfigFile(args []string) (*configFile, error) {
+	ca, err := preParseConfigFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	if ca.noConfig {
+		return emptyConfigFile(), nil
+	}
+	var cfg *configFile
+	if len(ca.path) == 0 {
+		cfg, err = newConfigFile(cfgFileName)
+	} else {
+		cfg, err = newConfigFileFromFlag(ca.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(ca.profile) == 0 && isConfigFlag(flag.Lookup(profileFlagName)) {
+		ca.profile = getenv(profileEnvName())
+	}
+	if len(ca.profile) > 0 && len(cfg.Paths()) > 0 {
+		if !cfg.hasProfile(ca.profile) {
+			return nil, errors.New("Profile " + ca.profile + " not found: no section [" +
+				profileSection(ca.profile) + "] in " + strings.Join(cfg.Paths(), ", "))
+		}
+		cfg.profile = ca.profile
+	}
+	return cfg, nil
+}
+
+// newConfigFileFromFlag reads the config file at path, as passed via
+// --config. The path is relative to the working dir, and the file must exist.
+func newConfigFileFromFlag(path string) (*configFile, error) {
+	if !filepath.IsAbs(path) {
+		wd, err := getwd()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(wd, path)
+	}
+	if _, err := statFile(path); err != nil {
+		return nil, errors.New("Cannot read config file: " + err.Error())
+	}
+	return newConfigFile(path)
+}
@@ -0,0 +1,154 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestConfigFlags(t *testing.T) {
+	Convey("Given a config file in the working dir and another one elsewhere", t, func() {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		var name string
+		flag.StringVarP(&name, "name", "n", "default", "A name")
+		SetFileSystem(fstest.MapFS{
+			"start.toml":       {Data: []byte(`name = "working dir"`)},
+			"other/other.toml": {Data: []byte(`name = "other"`)},
+		})
+		SetEnvLookup(mapEnv(map[string]string{}))
+
+		Convey("--config should select the config file", func() {
+			os.Args = []string{os.Args[0], "--config", "other/other.toml", "arg"}
+			So(Reparse(), ShouldBeNil)
+			So(name, ShouldEqual, "other")
+			So(ConfigFilePath(), ShouldEqual, filepath.FromSlash("/other/other.toml"))
+			So(flag.Args(), ShouldResemble, []string{"arg"})
+		})
+
+		Convey("--config should override SetConfigFile()", func() {
+			SetConfigFile("start.toml")
+			os.Args = []string{os.Args[0], "--config=other/other.toml"}
+			So(Reparse(), ShouldBeNil)
+			So(name, ShouldEqual, "other")
+		})
+
+		Convey("--config with a missing file should fail", func() {
+			os.Args = []string{os.Args[0], "--config=missing.toml"}
+			So(Reparse(), ShouldNotBeNil)
+		})
+
+		Convey("--no-config should skip reading any config file", func() {
+			os.Args = []string{os.Args[0], "--no-config"}
+			So(Reparse(), ShouldBeNil)
+			So(name, ShouldEqual, "default")
+			So(ConfigFilePath(), ShouldEqual, "")
+		})
+
+		Convey("--config and --no-config should not be read from the config file", func() {
+			SetFileSystem(fstest.MapFS{
+				"start.toml": {Data: []byte("no-config = true\nname = \"working dir\"")},
+			})
+			os.Args = []string{os.Args[0]}
+			So(Reparse(), ShouldBeNil)
+			So(name, ShouldEqual, "working dir")
+			So(flag.Lookup("no-config").Value.String(), ShouldEqual, "false")
+		})
+
+		Convey("arguments after -- should be ignored", func() {
+			os.Args = []string{os.Args[0], "--", "--config=other/other.toml"}
+			So(Reparse(), ShouldBeNil)
+			So(name, ShouldEqual, "working dir")
+		})
+
+		Reset(func() {
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+			cfgFileName = ""
+			customName = false
+		})
+	})
+
+	Convey("Given an application that defines its own --config flag", t, func() {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		var own string
+		flag.StringVar(&own, "config", "", "The application's own flag")
+		os.Args = []string{os.Args[0], "--config=whatever"}
+
+		Convey("start should leave that flag alone", func() {
+			So(Reparse(), ShouldBeNil)
+			So(own, ShouldEqual, "whatever")
+		})
+	})
+}
+
+func TestProfiles(t *testing.T) {
+	Convey("Given a config file with profiles", t, func() {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		var host, user string
+		var port int
+		flag.StringVar(&host, "host", "localhost", "The host")
+		flag.StringVar(&user, "user", "nobody", "The user")
+		flag.IntVar(&port, "port", 80, "The port")
+		SetFileSystem(fstest.MapFS{
+			"start.toml": {Data: []byte(`include = "common.toml"
+host = "dev.example.com"
+
+[profile.prod]
+host = "example.com"
+`)},
+			"common.toml": {Data: []byte(`user = "admin"
+port = 8080
+
+[profile.prod]
+port = 443
+`)},
+		})
+		env := map[string]string{}
+		SetEnvLookup(mapEnv(env))
+
+		Convey("without a profile, the base values should apply", func() {
+			os.Args = []string{os.Args[0]}
+			So(Reparse(), ShouldBeNil)
+			So(host, ShouldEqual, "dev.example.com")
+			So(port, ShouldEqual, 8080)
+		})
+
+		Convey("--profile should overlay the profile's values on the base values", func() {
+			os.Args = []string{os.Args[0], "--profile", "prod"}
+			So(Reparse(), ShouldBeNil)
+			So(host, ShouldEqual, "example.com")
+			So(port, ShouldEqual, 443)
+			So(user, ShouldEqual, "admin")
+		})
+
+		Convey("<APPNAME>_PROFILE should select the profile, too", func() {
+			env["START_PROFILE"] = "prod"
+			os.Args = []string{os.Args[0]}
+			So(Reparse(), ShouldBeNil)
+			So(host, ShouldEqual, "example.com")
+		})
+
+		Convey("an unknown profile should be reported", func() {
+			os.Args = []string{os.Args[0], "--profile=staging"}
+			err := Reparse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "profile.staging")
+		})
+
+		Reset(func() {
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+		})
+	})
+}
@@ -0,0 +1,185 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"errors"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// constraint checks a rule for the parsed flags and returns a message
+// for each violation. Rules ignore the flags for which active returns false,
+// as these belong to commands other than the one that runs.
+type constraint func(active func(name string) bool) []string
+
+// constraints is the list of rules registered via Require(),
+// MutuallyExclusive(), RequiredTogether(), and Validate().
+var constraints []constraint
+
+// Require makes the given flags mandatory. Each of them must be set by
+// the command line, an environment variable, or the config file;
+// the default value does not count.
+// Call Require before Parse() or Up(). Parse() reports all violated rules
+// together. Rules for the flags of a command (see Command.Flags) only apply
+// when this command runs. If the application has commands, Parse() checks
+// no rules unless the command line selects one of them, and never for the
+// "help" and "version" commands.
+func Require(names ...string) {
+	constraints = append(constraints, func(active func(string) bool) []string {
+		var msgs []string
+		for _, name := range names {
+			if !active(name) {
+				continue
+			}
+			f := flag.Lookup(name)
+			if f == nil {
+				msgs = append(msgs, unknownFlagMsg(name))
+				continue
+			}
+			if !isSet(name) {
+				msgs = append(msgs, "Missing required flag --"+name+" (or "+flagAlternatives(f)+")")
+			}
+		}
+		return msgs
+	})
+}
+
+// MutuallyExclusive allows at most one of the given flags to be set.
+// See Require() about when and how the rule is checked.
+func MutuallyExclusive(names ...string) {
+	constraints = append(constraints, func(active func(string) bool) []string {
+		names := activeNames(names, active)
+		set, msgs := setFlags(names)
+		if len(set) > 1 {
+			msgs = append(msgs, "Flags "+flagList(names)+" are mutually exclusive, but "+sourceList(set))
+		}
+		return msgs
+	})
+}
+
+// RequiredTogether requires that either all or none of the given flags
+// are set.
+// See Require() about when and how the rule is checked.
+func RequiredTogether(names ...string) {
+	constraints = append(constraints, func(active func(string) bool) []string {
+		names := activeNames(names, active)
+		set, msgs := setFlags(names)
+		if len(set) > 0 && len(set) < len(names) {
+			msgs = append(msgs, "Flags "+flagList(names)+" must be set together, but only "+sourceList(set))
+		}
+		return msgs
+	})
+}
+
+// Validate adds a custom validator for the flag with the given name.
+// The validator receives the flag's final value in its string
+// representation (see pflag.Value.String()) and returns an error if the
+// value is invalid. Validators also check default values.
+// See Require() about when and how the rule is checked.
+func Validate(name string, validator func(value string) error) {
+	constraints = append(constraints, func(active func(string) bool) []string {
+		if !active(name) {
+			return nil
+		}
+		f := flag.Lookup(name)
+		if f == nil {
+			return []string{unknownFlagMsg(name)}
+		}
+		if err := validator(f.Value.String()); err != nil {
+			return []string{"Invalid value for flag --" + name + " (" + flagSource(name) + "): " + err.Error()}
+		}
+		return nil
+	})
+}
+
+// checkConstraints checks the rules for the command that is about to run
+// and returns a single error that lists all violations, or nil if there
+// are none.
+func checkConstraints() error {
+	args := commandArgs()
+	if len(args) > 0 && (args[0] == "help" || args[0] == "version") {
+		return nil
+	}
+	if len(Commands) > 0 {
+		if len(args) == 0 {
+			// Up() prints the usage.
+			return nil
+		}
+		if _, isCmd := Commands[args[0]]; !isCmd || (shellEnabled && args[0] == "shell") {
+			// Up() prints the usage, or the shell checks each line.
+			return nil
+		}
+	}
+	active := activeFlags(args)
+	var msgs []string
+	for _, c := range constraints {
+		msgs = append(msgs, c(active)...)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// activeNames returns the names for which active returns true.
+func activeNames(names []string, active func(string) bool) []string {
+	var result []string
+	for _, name := range names {
+		if active(name) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// setFlags returns the names of the flags that are set, and messages
+// about names that are not flags.
+func setFlags(names []string) (set, msgs []string) {
+	for _, name := range names {
+		if flag.Lookup(name) == nil {
+			msgs = append(msgs, unknownFlagMsg(name))
+			continue
+		}
+		if isSet(name) {
+			set = append(set, name)
+		}
+	}
+	return set, msgs
+}
+
+// flagList returns the names as a list of flags: --a, --b.
+func flagList(names []string) string {
+	return "--" + strings.Join(names, ", --")
+}
+
+// sourceList lists the flags along with their sources.
+func sourceList(names []string) string {
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, "--"+name+" is set by "+flagSource(name))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// flagAlternatives lists the sources other than the command line that can
+// set flag f.
+func flagAlternatives(f *flag.Flag) string {
+	alternatives := "config file key " + configKey(f)
+	if env := envVarName(f); len(env) > 0 {
+		alternatives = "environment variable " + env + ", or " + alternatives
+	}
+	return alternatives
+}
+
+// unknownFlagMsg returns the message for a rule that refers to a flag
+// that does not exist.
+func unknownFlagMsg(name string) string {
+	return "Rule for unknown flag --" + name
+}
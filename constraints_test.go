@@ -0,0 +1,154 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestConstraints(t *testing.T) {
+	Convey("Given flags with constraints", t, func() {
+		ResetState()
+		flag.String("user", "", "")
+		flag.String("password", "", "")
+		flag.Bool("json", false, "")
+		flag.Bool("yaml", false, "")
+		flag.Int("port", 80, "")
+		SetFileSystem(fstest.MapFS{
+			"start.toml": {Data: []byte("yaml = true\nport = 70000")},
+		})
+		env := map[string]string{}
+		SetEnvLookup(mapEnv(env))
+
+		Require("user")
+		MutuallyExclusive("json", "yaml")
+		RequiredTogether("user", "password")
+		Validate("port", func(value string) error {
+			if port, _ := strconv.Atoi(value); port > 65535 {
+				return errors.New("port must not exceed 65535")
+			}
+			return nil
+		})
+
+		Convey("all violations should be reported together, with their sources", func() {
+			os.Args = []string{os.Args[0], "--json"}
+			err := Reparse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Missing required flag --user (or environment variable START_USER, or config file key user)")
+			So(err.Error(), ShouldContainSubstring, "Flags --json, --yaml are mutually exclusive, but --json is set by command line and --yaml is set by config file "+filepath.FromSlash("/start.toml")+":1")
+			So(err.Error(), ShouldContainSubstring, "Invalid value for flag --port (config file "+filepath.FromSlash("/start.toml")+":2): port must not exceed 65535")
+			So(err.Error(), ShouldNotContainSubstring, "must be set together")
+		})
+
+		Convey("flags that are set together should pass", func() {
+			env["START_USER"] = "joe"
+			os.Args = []string{os.Args[0], "--password=secret", "--port=8080"}
+			So(Reparse(), ShouldBeNil)
+			So(FlagSource("user"), ShouldEqual, "environment variable START_USER")
+			So(FlagSource("password"), ShouldEqual, "command line")
+			So(FlagSource("json"), ShouldEqual, "default")
+
+			Convey("but not if one of them is missing", func() {
+				os.Args = []string{os.Args[0], "--port=8080"}
+				flag.CommandLine.Lookup("password").Changed = false
+				err := Reparse()
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Flags --user, --password must be set together, but only --user is set by environment variable START_USER")
+			})
+		})
+
+		Convey("the rules should not apply to the help command", func() {
+			os.Args = []string{os.Args[0], "help"}
+			So(Reparse(), ShouldBeNil)
+		})
+
+		Convey("rules for unknown flags should be reported", func() {
+			Require("nonexistent")
+			os.Args = []string{os.Args[0], "--password=secret", "--port=8080"}
+			env["START_USER"] = "joe"
+			So(Reparse().Error(), ShouldEqual, "Rule for unknown flag --nonexistent")
+		})
+
+		Reset(func() {
+			constraints = nil
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+		})
+	})
+	Convey("Given commands with flags of their own and rules for them", t, func() {
+		oldArgs := os.Args
+		ResetState()
+		SetEnvLookup(mapEnv(map[string]string{}))
+		flag.String("host", "", "")
+		flag.String("token", "", "")
+		flag.String("user", "", "")
+		flag.String("password", "", "")
+		var ran []string
+		run := func(cmd *Command) error {
+			ran = append(ran, cmd.Name)
+			return nil
+		}
+		Add(&Command{Name: "login", Flags: []string{"token", "user", "password"}, Cmd: run})
+		Add(&Command{Name: "status", Cmd: run})
+		Require("token")
+		RequiredTogether("user", "password", "host")
+
+		Convey("the rules should apply to the command that has the flags", func() {
+			os.Args = []string{os.Args[0], "login", "--user=joe"}
+			err := Reparse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Missing required flag --token")
+			So(err.Error(), ShouldContainSubstring, "Flags --user, --password, --host must be set together")
+		})
+
+		Convey("the rules should ignore the flags of other commands", func() {
+			os.Args = []string{os.Args[0], "--host=example.com", "status"}
+			So(Reparse(), ShouldBeNil)
+			Up()
+			So(ExitCode(), ShouldEqual, 0)
+			So(ran, ShouldResemble, []string{"status"})
+		})
+
+		Convey("the rules for global flags should apply to all commands", func() {
+			Require("host")
+			os.Args = []string{os.Args[0], "status"}
+			err := Reparse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Missing required flag --host (or environment variable START_HOST, or config file key host)")
+		})
+
+		Convey("without a command, Up should print the usage instead of checking the rules", func() {
+			os.Args = []string{os.Args[0]}
+			out := captureStderr(Up)
+			So(ExitCode(), ShouldEqual, 0)
+			So(out, ShouldContainSubstring, "Available commands:")
+			So(out, ShouldNotContainSubstring, "Missing required flag")
+		})
+
+		Convey("with an unknown command, Up should print the usage instead of checking the rules", func() {
+			os.Args = []string{os.Args[0], "bogus"}
+			out := captureStderr(Up)
+			So(out, ShouldContainSubstring, "Available commands:")
+			So(out, ShouldNotContainSubstring, "Missing required flag")
+			So(ran, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			os.Args = oldArgs
+			ResetState()
+		})
+	})
+}
@@ -8,6 +8,10 @@
 package start
 
 import (
+	"context"
+	"io"
+	"sync/atomic"
+
 	"github.com/laurent22/toml-go"
 )
 
@@ -32,27 +36,83 @@ type privateFlagsMap map[string]bool
 // Cmd contains the function to execute. It receives the list of
 // arguments (without the flags, which are parsed already).
 // For commands with child commands, Cmd can be left empty.
+// RunE is the context-aware alternative to Cmd. If set, Up() calls RunE
+// instead of Cmd. The context gets cancelled when the application receives
+// SIGINT or SIGTERM (see SetGracePeriod()).
+// PreRun and PostRun are optional hooks that run immediately before and after
+// the command. PostRun runs only if the command succeeded.
+// PersistentPreRun and PersistentPostRun are the same kind of hooks but they
+// also apply to all subcommands. A subcommand uses the persistent hook of the
+// nearest command in its parent chain (including itself) that defines one.
+// Persistent pre-run hooks run before PreRun, persistent post-run hooks
+// run after PostRun.
 // Args gets filled with all arguments, excluding flags.
 // Path is an optional path to external executables that reside outside
 // $PATH. To be used with the External() function.
+// Options is an optional pointer to a struct whose fields become flags that
+// only this command accepts. Add() registers the flags as described for
+// BindFlags() and appends their names to Flags.
+// Group is an optional section of the help output, like "Management
+// Commands", that lists the command together with the other commands of
+// the same group (see SetGroupOrder() and KeepCommandOrder()).
+// Stdin, Stdout, and Stderr are the streams that the command reads from and
+// writes to. Nil streams are inherited from the parent command, or else
+// default to the streams set by SetStreams() or to os.Stdin, os.Stdout,
+// and os.Stderr. Up() fills in the nil streams while the command runs, so
+// that Cmd and RunE can use them directly.
 type Command struct {
-	Name     string
-	Parent   string
-	Flags    []string
-	Short    string
-	Long     string
-	Cmd      func(cmd *Command) error
-	Args     []string
-	Path     string
-	children CommandMap
+	Name   string
+	Parent string
+	Flags  []string
+	Short  string
+	Long   string
+	Cmd    func(cmd *Command) error
+	RunE   func(ctx context.Context, cmd *Command) error
+	Args   []string
+	Path   string
+	Group  string
+
+	Options interface{}
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	PreRun            func(cmd *Command) error
+	PostRun           func(cmd *Command) error
+	PersistentPreRun  func(cmd *Command) error
+	PersistentPostRun func(cmd *Command) error
+
+	children     CommandMap
+	optionsBound bool
+	seq          int // order of registration, see KeepCommandOrder()
+	ctx          context.Context
+	ctxRequested atomic.Bool // true once Context() has been called
 }
 
+// CmdFunc is the context-aware form of a command's function.
+// Middleware sees every command as a CmdFunc, regardless of whether the
+// command defines Cmd or RunE.
+type CmdFunc func(ctx context.Context, cmd *Command) error
+
+// Middleware wraps a CmdFunc into another CmdFunc. See Use().
+type Middleware func(next CmdFunc) CmdFunc
+
 //// Configuration File Declarations
 
 // ConfigFile represents a configuration file.
 // If the application has no configuration file, then doc is an empty
 // toml.Document and path is empty.
+// Layers are config files with lower precedence, like included files or the
+// files from the system config dirs. They provide values for keys that doc
+// does not contain.
+// Profile is the name of the selected profile, if any. Values from the
+// section [profile.<profile>] override the top-level values.
 type configFile struct {
-	doc  toml.Document
-	path string
+	doc      toml.Document
+	path     string
+	layers   []*configFile
+	profile  string
+	sections map[string]bool // cache for hasSection()
+	lines    []string        // raw content, for reporting line numbers
 }
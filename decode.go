@@ -0,0 +1,331 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laurent22/toml-go"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// DecodeConfig copies the settings from the config file section with the
+// given name into the struct that v points to. An empty section name
+// selects the top-level settings; a dotted name like "server.tls" selects
+// a nested section.
+//
+// Each exported field receives the value of the key named in the field's
+// "toml" tag, or of the key that equals the lower-case field name if the
+// field has no such tag. A "toml" tag of "-" skips the field. If the key
+// does not exist, the field receives the value of its "default" tag, if
+// any; if the field's "required" tag is "true", the missing key is an error.
+//
+//	type Server struct {
+//		Host    string        `toml:"host" required:"true"`
+//		Port    int           `toml:"port" default:"8080"`
+//		Timeout time.Duration `toml:"timeout" default:"30s"`
+//		Tags    []string      `toml:"tags"`
+//		TLS     struct {
+//			Cert string `toml:"cert"`
+//		} `toml:"tls"`
+//	}
+//
+//	var server Server
+//	err := start.DecodeConfig("server", &server)
+//
+// Supported field types are strings, bools, ints, uints, floats,
+// time.Duration (from strings like "1m30s"), time.Time (from TOML dates),
+// slices of these (from TOML arrays), maps from string to these (from the
+// keys of a section), and structs (from the nested section of the same
+// name).
+// Like flags, DecodeConfig sees the settings of the selected profile and of
+// all config file layers. Errors refer to the file and line of the
+// offending setting.
+// Use after calling Up() or Parse().
+func DecodeConfig(section string, v interface{}) error {
+	parseMu.Lock()
+	defer parseMu.Unlock()
+	cfg := Settings().cfg
+	if cfg == nil {
+		return errors.New("DecodeConfig: no config file read yet. Call Parse() or Up() first.")
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("DecodeConfig: v must be a non-nil pointer to a struct, not " + fmt.Sprintf("%T", v))
+	}
+	return decodeStruct(cfg, section, rv.Elem())
+}
+
+// decodeStruct decodes the section into the fields of struct rv.
+func decodeStruct(c *configFile, section string, rv reflect.Value) error {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+		name := field.Tag.Get("toml")
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = strings.ToLower(field.Name)
+		}
+		key := name
+		if len(section) > 0 {
+			key = section + "." + name
+		}
+		err := decodeField(c, key, field, rv.Field(i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeField sets the struct field fv from the setting with the given key,
+// or from the field's default value.
+func decodeField(c *configFile, key string, field reflect.StructField, fv reflect.Value) error {
+	if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+		return decodeStruct(c, key, fv)
+	}
+	if fv.Kind() == reflect.Map {
+		return decodeMap(c, key, fv)
+	}
+	s, exists := c.setting(key)
+	if !exists {
+		if def, ok := field.Tag.Lookup("default"); ok {
+			err := decodeString(def, fv)
+			if err != nil {
+				return errors.New("Invalid default value for config setting " + key + ": " + err.Error())
+			}
+			return nil
+		}
+		if field.Tag.Get("required") == "true" {
+			return errors.New(missingSettingMsg(c, key))
+		}
+		return nil
+	}
+	err := decodeValue(s.value, fv)
+	if err != nil {
+		return errors.New(s.position() + ": " + key + ": " + err.Error())
+	}
+	return nil
+}
+
+// decodeMap fills map fv with all values from the section.
+func decodeMap(c *configFile, section string, fv reflect.Value) error {
+	if fv.Type().Key().Kind() != reflect.String {
+		return errors.New("Cannot decode config section " + section + " into " + fv.Type().String() + ": map keys must be strings")
+	}
+	keys := c.keys(section)
+	if len(keys) == 0 {
+		return nil
+	}
+	if fv.IsNil() {
+		fv.Set(reflect.MakeMap(fv.Type()))
+	}
+	for _, name := range keys {
+		key := section + "." + name
+		s, _ := c.setting(key)
+		elem := reflect.New(fv.Type().Elem()).Elem()
+		err := decodeValue(s.value, elem)
+		if err != nil {
+			return errors.New(s.position() + ": " + key + ": " + err.Error())
+		}
+		fv.SetMapIndex(reflect.ValueOf(name).Convert(fv.Type().Key()), elem)
+	}
+	return nil
+}
+
+// decodeValue sets rv from a TOML value.
+func decodeValue(value toml.Value, rv reflect.Value) error {
+	kind := valueKind(value)
+	mismatch := errors.New("cannot use " + kindName(kind) + " " + value.String() + " as " + rv.Type().String())
+	switch {
+	case rv.Type() == durationType:
+		if kind != kindString {
+			return mismatch
+		}
+		return decodeString(value.AsString(), rv)
+	case rv.Type() == timeType:
+		if kind != kindDate {
+			return mismatch
+		}
+		rv.Set(reflect.ValueOf(value.AsDate()))
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		if kind != kindString {
+			return mismatch
+		}
+		rv.SetString(value.AsString())
+	case reflect.Bool:
+		if kind != kindBool {
+			return mismatch
+		}
+		rv.SetBool(value.AsBool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if kind != kindInt && !(kind == kindFloat && isFloat(rv)) {
+			return mismatch
+		}
+		return decodeString(value.String(), rv)
+	case reflect.Slice:
+		if kind != kindArray {
+			return mismatch
+		}
+		array := value.AsArray()
+		slice := reflect.MakeSlice(rv.Type(), len(array), len(array))
+		for i, elem := range array {
+			err := decodeValue(elem, slice.Index(i))
+			if err != nil {
+				return errors.New("element " + strconv.Itoa(i) + ": " + err.Error())
+			}
+		}
+		rv.Set(slice)
+	default:
+		return errors.New("unsupported type " + rv.Type().String())
+	}
+	return nil
+}
+
+// decodeString sets rv from its string representation. Used for default
+// values and for numbers. Slice elements are separated by commas.
+func decodeString(s string, rv reflect.Value) error {
+	switch {
+	case rv.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		rv.SetInt(int64(d))
+		return nil
+	case rv.Type() == timeType:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(f)
+	case reflect.Slice:
+		var parts []string
+		if len(s) > 0 {
+			parts = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(rv.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			err := decodeString(strings.TrimSpace(part), slice.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		rv.Set(slice)
+	default:
+		return errors.New("unsupported type " + rv.Type().String())
+	}
+	return nil
+}
+
+// isFloat returns true if rv is a float.
+func isFloat(rv reflect.Value) bool {
+	return rv.Kind() == reflect.Float32 || rv.Kind() == reflect.Float64
+}
+
+// kindName returns a readable name of a TOML value kind, for error messages.
+func kindName(kind int) string {
+	return [...]string{"no value", "string", "bool", "integer", "float", "date", "array"}[kind]
+}
+
+// missingSettingMsg returns the error message for a missing required setting.
+func missingSettingMsg(c *configFile, key string) string {
+	paths := c.Paths()
+	if len(paths) == 0 {
+		return "Missing required config setting " + key + ": no config file found"
+	}
+	return "Missing required config setting " + key + " in " + strings.Join(paths, ", ")
+}
+
+// position returns "path:line" for the setting, or just the path if the
+// line is unknown.
+func (s setting) position() string {
+	line := s.file.line(s.key)
+	if line == 0 {
+		return s.file.path
+	}
+	return s.file.path + ":" + strconv.Itoa(line)
+}
+
+// keys returns the names of all values in the section, from the config file,
+// its layers, and the section of the selected profile. Subsections are not
+// included.
+func (c *configFile) keys(section string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	var collect func(f *configFile, section string)
+	collect = func(f *configFile, section string) {
+		if f.hasSection(section) {
+			node, _ := f.doc.GetSection(section)
+			for name := range node.Children {
+				if _, isValue := f.get(section + "." + name); isValue && !seen[name] {
+					seen[name] = true
+					keys = append(keys, name)
+				}
+			}
+		}
+		for _, layer := range f.layers {
+			collect(layer, section)
+		}
+	}
+	if len(c.profile) > 0 {
+		collect(c, profileSection(c.profile)+"."+section)
+	}
+	collect(c, section)
+	sort.Strings(keys)
+	return keys
+}
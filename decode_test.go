@@ -0,0 +1,133 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+type testServer struct {
+	Host    string        `toml:"host" required:"true"`
+	Port    int           `toml:"port" default:"8080"`
+	Ratio   float64       `toml:"ratio"`
+	Debug   bool          `toml:"debug"`
+	Timeout time.Duration `toml:"timeout" default:"30s"`
+	Started time.Time     `toml:"started"`
+	Tags    []string      `toml:"tags"`
+	Ports   []uint16      `toml:"ports" default:"80, 443"`
+	Limits  map[string]int
+	TLS     struct {
+		Cert string `toml:"cert"`
+	} `toml:"tls"`
+	Ignored string `toml:"-"`
+}
+
+func TestDecodeConfig(t *testing.T) {
+	Convey("Given a config file with a structured section", t, func() {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		os.Args = []string{os.Args[0]}
+		SetFileSystem(fstest.MapFS{
+			"start.toml": {Data: []byte(`include = "common.toml"
+name = "app"
+
+[server]
+host = "example.com"
+ratio = 2
+timeout = "1m"
+started = 2014-08-17T09:25:00Z
+tags = ["a", "b"]
+Ignored = "ignored"
+
+[server.limits]
+cpu = 2
+
+[server.tls]
+cert = "cert.pem"
+
+[bad]
+host = 42
+
+[profile.prod.server]
+host = "prod.example.com"
+`)},
+			"common.toml": {Data: []byte(`[server]
+debug = true
+
+[server.limits]
+cpu = 1
+mem = 512
+`)},
+		})
+		SetEnvLookup(mapEnv(map[string]string{}))
+		So(Reparse(), ShouldBeNil)
+
+		Convey("DecodeConfig should fill the struct from the section, its layers, and the defaults", func() {
+			var server testServer
+			So(DecodeConfig("server", &server), ShouldBeNil)
+			So(server.Host, ShouldEqual, "example.com")
+			So(server.Port, ShouldEqual, 8080)
+			So(server.Ratio, ShouldEqual, 2.0)
+			So(server.Debug, ShouldBeTrue)
+			So(server.Timeout, ShouldEqual, time.Minute)
+			So(server.Started, ShouldEqual, time.Date(2014, 8, 17, 9, 25, 0, 0, time.UTC))
+			So(server.Tags, ShouldResemble, []string{"a", "b"})
+			So(server.Ports, ShouldResemble, []uint16{80, 443})
+			So(server.Limits, ShouldResemble, map[string]int{"cpu": 2, "mem": 512})
+			So(server.TLS.Cert, ShouldEqual, "cert.pem")
+			So(server.Ignored, ShouldEqual, "")
+		})
+
+		Convey("DecodeConfig should use the settings of the selected profile", func() {
+			os.Args = []string{os.Args[0], "--profile=prod"}
+			So(Reparse(), ShouldBeNil)
+			var server testServer
+			So(DecodeConfig("server", &server), ShouldBeNil)
+			So(server.Host, ShouldEqual, "prod.example.com")
+			So(server.TLS.Cert, ShouldEqual, "cert.pem")
+		})
+
+		Convey("An empty section name should select the top-level settings", func() {
+			var top struct{ Name string }
+			So(DecodeConfig("", &top), ShouldBeNil)
+			So(top.Name, ShouldEqual, "app")
+		})
+
+		Convey("A value of the wrong type should be reported with file and line", func() {
+			var server testServer
+			err := DecodeConfig("bad", &server)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, filepath.FromSlash("/start.toml")+":19: bad.host: cannot use integer 42 as string")
+		})
+
+		Convey("A missing required setting should be reported", func() {
+			var server testServer
+			err := DecodeConfig("missing", &server)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "missing.host")
+		})
+
+		Convey("DecodeConfig should only accept pointers to structs", func() {
+			var server testServer
+			So(DecodeConfig("server", server), ShouldNotBeNil)
+			So(DecodeConfig("server", nil), ShouldNotBeNil)
+			So(DecodeConfig("server", (*testServer)(nil)), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+		})
+	})
+}
@@ -0,0 +1,114 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Access to the file system and to environment variables goes through the
+// functions in this file, so that tests and applications can replace them.
+var (
+	// fileSystem is the file system in which start looks for config files.
+	// If nil, start uses the operating system's file system.
+	fileSystem fs.FS
+
+	// lookupEnv looks up an environment variable.
+	lookupEnv = os.LookupEnv
+
+	// workingDir overrides the working directory if not empty.
+	workingDir string
+)
+
+// SetFileSystem sets the file system in which start looks for config files.
+// By default, start uses the file system of the operating system.
+//
+// With a custom file system, all paths are resolved against the root of fsys:
+// absolute paths lose their leading slash (and volume name), and the root
+// also serves as the working directory. This allows testing config discovery
+// with an in-memory file system (for example, testing/fstest.MapFS), or
+// shipping a config file with the binary via embed.FS:
+//
+//	//go:embed myapp.toml
+//	var defaultConfig embed.FS
+//	...
+//	start.SetFileSystem(defaultConfig)
+//
+// Pass nil to restore the default.
+func SetFileSystem(fsys fs.FS) {
+	fileSystem = fsys
+}
+
+// SetEnvLookup sets the function that start uses for reading environment
+// variables: the variables for flag values, <APPNAME>_CFGPATH, and the
+// variables that determine the user's config directory. The function has the
+// same signature as os.LookupEnv, which is the default.
+// Pass nil to restore the default.
+func SetEnvLookup(lookup func(key string) (string, bool)) {
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	lookupEnv = lookup
+}
+
+// SetWorkingDir sets the directory that config discovery uses as the
+// working directory. By default, this is the process's working directory,
+// or the root of the file system set via SetFileSystem().
+// Pass an empty string to restore the default.
+func SetWorkingDir(dir string) {
+	workingDir = dir
+}
+
+// getenv returns the value of the environment variable key,
+// or an empty string if the variable is not set.
+func getenv(key string) string {
+	value, _ := lookupEnv(key)
+	return value
+}
+
+// getwd returns the working directory.
+func getwd() (string, error) {
+	if workingDir != "" {
+		return workingDir, nil
+	}
+	if fileSystem == nil {
+		return os.Getwd()
+	}
+	return string(filepath.Separator), nil
+}
+
+// statFile returns the FileInfo of the file at path.
+func statFile(name string) (fs.FileInfo, error) {
+	if fileSystem == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(fileSystem, fsPath(name))
+}
+
+// readFile returns the contents of the file at path.
+func readFile(name string) ([]byte, error) {
+	if fileSystem == nil {
+		return os.ReadFile(name)
+	}
+	return fs.ReadFile(fileSystem, fsPath(name))
+}
+
+// fsPath converts an operating system path into a path that is valid for
+// the fs.FS interface, that is, unrooted and slash-separated.
+func fsPath(name string) string {
+	name = filepath.ToSlash(strings.TrimPrefix(name, filepath.VolumeName(name)))
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
@@ -0,0 +1,96 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mapEnv returns an env lookup function that reads from env.
+func mapEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestFsPath(t *testing.T) {
+	Convey("fsPath should turn OS paths into fs.FS paths", t, func() {
+		So(fsPath(string(filepath.Separator)), ShouldEqual, ".")
+		So(fsPath(filepath.Join(string(filepath.Separator), "home", "u", "start.toml")), ShouldEqual, "home/u/start.toml")
+		So(fsPath(filepath.Join("test", "..", "start.toml")), ShouldEqual, "start.toml")
+	})
+}
+
+func TestConfigDiscovery(t *testing.T) {
+	Convey("Given an in-memory file system and environment", t, func() {
+		fsys := fstest.MapFS{
+			"start.toml":                       {Data: []byte(`where = "working dir"`)},
+			"home/u/.config/start/config.toml": {Data: []byte(`where = "user config dir"`)},
+			"etc/start/start.toml":             {Data: []byte(`where = "cfgpath dir"`)},
+			"etc/start/custom.toml":            {Data: []byte(`where = "cfgpath custom"`)},
+			"opt/start.toml":                   {Data: []byte(`where = "absolute path"`)},
+			"home/u/.config/start/custom.toml": {Data: []byte(`where = "user config custom"`)},
+		}
+		// LOCALAPPDATA makes the test work on Windows, too.
+		env := map[string]string{"HOME": "/home/u", "LOCALAPPDATA": "/home/u/.config"}
+		SetFileSystem(fsys)
+		SetEnvLookup(mapEnv(env))
+
+		Convey("the user config dir should take precedence over the working dir", func() {
+			cfg, err := newConfigFile("")
+			So(err, ShouldBeNil)
+			So(cfg.String("where"), ShouldEqual, "user config dir")
+			So(cfg.Path(), ShouldEqual, filepath.FromSlash("/home/u/.config/start/config.toml"))
+		})
+
+		Convey("the working dir should be searched for <appname>.toml", func() {
+			delete(fsys, "home/u/.config/start/config.toml")
+			cfg, _ := newConfigFile("")
+			So(cfg.String("where"), ShouldEqual, "working dir")
+			So(cfg.Path(), ShouldEqual, filepath.FromSlash("/start.toml"))
+		})
+
+		Convey("<APPNAME>_CFGPATH should take precedence over the user config dir", func() {
+			env["START_CFGPATH"] = "/etc/start"
+			cfg, _ := newConfigFile("")
+			So(cfg.String("where"), ShouldEqual, "cfgpath dir")
+
+			Convey("also for custom file names", func() {
+				cfg, _ := newConfigFile("custom.toml")
+				So(cfg.String("where"), ShouldEqual, "cfgpath custom")
+			})
+		})
+
+		Convey("a custom file name should be searched in the user config dir", func() {
+			cfg, _ := newConfigFile("custom.toml")
+			So(cfg.String("where"), ShouldEqual, "user config custom")
+		})
+
+		Convey("an absolute path should be read directly", func() {
+			cfg, _ := newConfigFile(filepath.FromSlash("/opt/start.toml"))
+			So(cfg.String("where"), ShouldEqual, "absolute path")
+		})
+
+		Convey("environment variables should come from the lookup function", func() {
+			So(getenv("HOME"), ShouldEqual, "/home/u")
+			dir, exists := GetUserConfigDir()
+			So(dir, ShouldEqual, filepath.FromSlash("/home/u/.config/start"))
+			So(exists, ShouldBeTrue)
+		})
+
+		Reset(func() {
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+		})
+	})
+}
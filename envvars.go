@@ -0,0 +1,97 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	envPrefix       string
+	customEnvPrefix bool // if false, the prefix is the app name
+)
+
+// invalidEnvChars matches all characters that shells do not accept in the
+// names of environment variables.
+var invalidEnvChars = regexp.MustCompile("[^A-Z0-9_]")
+
+// SetEnvPrefix sets the prefix of the environment variables for flags.
+// By default, the prefix is the application name, so that the flag
+// --dry-run receives its value from <APPNAME>_DRY_RUN. With a prefix of
+// "MYAPP", the variable is MYAPP_DRY_RUN. An empty prefix omits the prefix
+// altogether: DRY_RUN.
+// Flag names are converted to upper case, and all characters other than
+// letters, digits, and underscores become underscores.
+// The prefix does not apply to <APPNAME>_CFGPATH and <APPNAME>_PROFILE.
+// Call SetEnvPrefix before Parse() or Up().
+func SetEnvPrefix(prefix string) {
+	envPrefix = prefix
+	customEnvPrefix = true
+}
+
+// SetEnvName sets the name of the environment variable for the flag with
+// the given name, instead of <PREFIX>_<FLAGNAME>. An empty name means that
+// no environment variable sets the flag.
+// Call SetEnvName before Parse() or Up().
+func SetEnvName(flagName, envName string) error {
+	err := flag.CommandLine.SetAnnotation(flagName, envAnnotation, []string{envName})
+	if err != nil {
+		return errors.New("SetEnvName: " + err.Error())
+	}
+	return nil
+}
+
+// EnvName returns the name of the environment variable for the flag with
+// the given name, or an empty string if no environment variable sets the
+// flag.
+func EnvName(flagName string) string {
+	f := flag.Lookup(flagName)
+	if f == nil {
+		return ""
+	}
+	return envVarName(f)
+}
+
+// envVarName returns the name of the environment variable for flag f:
+// the name from the flag's env annotation, if any, or <PREFIX>_<FLAGNAME>.
+// Of the config flags, only --profile has an environment variable.
+func envVarName(f *flag.Flag) string {
+	if isConfigFlag(f) {
+		if f.Name == profileFlagName {
+			return profileEnvName()
+		}
+		return ""
+	}
+	if env, ok := f.Annotations[envAnnotation]; ok && len(env) > 0 {
+		return env[0]
+	}
+	prefix := envPrefix
+	if !customEnvPrefix {
+		prefix = appName()
+	}
+	if len(prefix) > 0 {
+		prefix += "_"
+	}
+	return invalidEnvChars.ReplaceAllString(strings.ToUpper(prefix+f.Name), "_")
+}
+
+// profileEnvName returns the name of the environment variable that
+// selects the profile.
+func profileEnvName() string {
+	return appEnvName("PROFILE")
+}
+
+// appEnvName returns the name of an environment variable that configures
+// start itself: <APPNAME>_<suffix>.
+func appEnvName(suffix string) string {
+	return invalidEnvChars.ReplaceAllString(strings.ToUpper(appName()+"_"+suffix), "_")
+}
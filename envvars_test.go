@@ -0,0 +1,90 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestEnvNames(t *testing.T) {
+	Convey("Given flags with dashes and dots in their names", t, func() {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		os.Args = []string{os.Args[0]}
+		dryRun := flag.Bool("dry-run", false, "")
+		logLevel := flag.String("log.level", "info", "")
+		SetFileSystem(fstest.MapFS{})
+		env := map[string]string{}
+		SetEnvLookup(mapEnv(env))
+
+		Convey("the default env names should use the app name as prefix and underscores", func() {
+			So(EnvName("dry-run"), ShouldEqual, "START_DRY_RUN")
+			So(EnvName("log.level"), ShouldEqual, "START_LOG_LEVEL")
+			env["START_DRY_RUN"] = "true"
+			So(Reparse(), ShouldBeNil)
+			So(*dryRun, ShouldBeTrue)
+		})
+
+		Convey("SetEnvPrefix should replace the prefix", func() {
+			SetEnvPrefix("my-app")
+			So(EnvName("dry-run"), ShouldEqual, "MY_APP_DRY_RUN")
+		})
+
+		Convey("an empty prefix should omit the prefix", func() {
+			SetEnvPrefix("")
+			So(EnvName("dry-run"), ShouldEqual, "DRY_RUN")
+			env["LOG_LEVEL"] = "debug"
+			So(Reparse(), ShouldBeNil)
+			So(*logLevel, ShouldEqual, "debug")
+		})
+
+		Convey("SetEnvName should set a custom name", func() {
+			So(SetEnvName("log.level", "LOGLEVEL"), ShouldBeNil)
+			So(EnvName("log.level"), ShouldEqual, "LOGLEVEL")
+			env["LOGLEVEL"] = "warn"
+			env["START_LOG_LEVEL"] = "ignored"
+			So(Reparse(), ShouldBeNil)
+			So(*logLevel, ShouldEqual, "warn")
+		})
+
+		Convey("an empty custom name should disable the env var", func() {
+			So(SetEnvName("dry-run", ""), ShouldBeNil)
+			So(EnvName("dry-run"), ShouldEqual, "")
+			env["START_DRY_RUN"] = "true"
+			So(Reparse(), ShouldBeNil)
+			So(*dryRun, ShouldBeFalse)
+			out := captureStderr(func() { flagUsage(os.Stderr, []string{"dry-run", "log.level"}) })
+			So(out, ShouldNotContainSubstring, "DRY_RUN")
+			So(out, ShouldContainSubstring, "[$START_LOG_LEVEL]")
+		})
+
+		Convey("the env tag \"-\" should disable the env var for a bound flag", func() {
+			var opts struct {
+				Token string `env:"-"`
+			}
+			_, err := BindFlags(&opts)
+			So(err, ShouldBeNil)
+			So(EnvName("token"), ShouldEqual, "")
+		})
+
+		Convey("SetEnvName should fail for unknown flags", func() {
+			So(SetEnvName("unknown", "X"), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			envPrefix = ""
+			customEnvPrefix = false
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+		})
+	})
+}
@@ -6,4 +6,10 @@ require (
 	github.com/spf13/pflag v1.0.10
 )
 
-go 1.13
+require (
+	github.com/gopherjs/gopherjs v1.17.2 // indirect
+	github.com/jtolds/gls v4.20.0+incompatible // indirect
+	github.com/smarty/assertions v1.15.0 // indirect
+)
+
+go 1.21
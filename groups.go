@@ -0,0 +1,175 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	flag "github.com/spf13/pflag"
+)
+
+// groupAnnotation assigns a flag to a group in the help output.
+const groupAnnotation = "start_group"
+
+var (
+	// groupOrder lists the groups that come first in the help output.
+	groupOrder []string
+	// keepCommandOrder is true if the help lists commands in the order in
+	// which they were added.
+	keepCommandOrder bool
+	// commandCount counts the commands that Add() has registered.
+	commandCount int
+)
+
+// FlagGroup assigns the flags with the given names to a group. The help
+// output lists the flags of each group in a section of their own, headed by
+// the group name, for example "Network Flags". Flags without a group appear
+// in the general list of flags, before the groups.
+// Call FlagGroup after defining the flags. For flags defined through
+// BindFlags(), use the tag `group:"<group>"`.
+func FlagGroup(group string, names ...string) error {
+	for _, name := range names {
+		err := flag.CommandLine.SetAnnotation(name, groupAnnotation, []string{group})
+		if err != nil {
+			return errors.New("FlagGroup: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// SetGroupOrder sets the order of the command groups (see Command.Group)
+// and the flag groups (see FlagGroup()) in the help output. Groups that
+// groups does not contain follow in alphabetical order.
+func SetGroupOrder(groups ...string) {
+	groupOrder = groups
+}
+
+// KeepCommandOrder makes the help output list commands and subcommands in
+// the order in which Add() has registered them, rather than sorted by name.
+// The built-in commands come last.
+func KeepCommandOrder() {
+	keepCommandOrder = true
+}
+
+// countCommand numbers the command in the order of registration.
+func (cmd *Command) countCommand() {
+	if cmd.seq == 0 {
+		commandCount++
+		cmd.seq = commandCount
+	}
+}
+
+// flagGroup returns the group of flag f, or "" if f belongs to no group.
+func flagGroup(f *flag.Flag) string {
+	if group := f.Annotations[groupAnnotation]; len(group) > 0 {
+		return group[0]
+	}
+	return ""
+}
+
+// sortedGroups returns the groups in the order of SetGroupOrder(), followed
+// by the remaining groups in alphabetical order.
+func sortedGroups(groups map[string]bool) []string {
+	var sorted, rest []string
+	for _, group := range groupOrder {
+		if groups[group] {
+			sorted = append(sorted, group)
+			delete(groups, group)
+		}
+	}
+	for group := range groups {
+		rest = append(rest, group)
+	}
+	sort.Strings(rest)
+	return append(sorted, rest...)
+}
+
+// sortCommands sorts commands by name, or in the order of registration if
+// KeepCommandOrder() has been called.
+func sortCommands(cmds []*Command) {
+	sort.Slice(cmds, func(i, j int) bool {
+		a, b := cmds[i], cmds[j]
+		if keepCommandOrder && a.seq != b.seq {
+			// Commands that Add() has not registered come last.
+			return a.seq != 0 && (b.seq == 0 || a.seq < b.seq)
+		}
+		return a.Name < b.Name
+	})
+}
+
+// commandListUsage lists the commands without a group below heading,
+// followed by a section for each group of commands.
+func commandListUsage(w io.Writer, heading string, cmds []*Command) {
+	sortCommands(cmds)
+	width := 0
+	sections := map[string][]*Command{}
+	groups := map[string]bool{}
+	for _, c := range cmds {
+		if width < len(c.Name) {
+			width = len(c.Name)
+		}
+		sections[c.Group] = append(sections[c.Group], c)
+		if len(c.Group) > 0 {
+			groups[c.Group] = true
+		}
+	}
+	first := true
+	for _, group := range append([]string{""}, sortedGroups(groups)...) {
+		if len(sections[group]) == 0 {
+			continue
+		}
+		if !first {
+			fmt.Fprintln(w)
+		}
+		if len(group) > 0 {
+			heading = group + ":"
+		}
+		fmt.Fprintln(w, heading)
+		fmt.Fprintln(w)
+		for _, c := range sections[group] {
+			fmt.Fprintf(w, "%-*s  %s\n", width, c.Name, c.Short)
+		}
+		first = false
+	}
+}
+
+// flagListUsage lists the flags without a group below heading, followed by
+// a section for each group of flags.
+func flagListUsage(w io.Writer, heading string, names []string) {
+	sections := map[string][]string{}
+	groups := map[string]bool{}
+	for _, name := range names {
+		group := ""
+		if f := flag.Lookup(name); f != nil {
+			group = flagGroup(f)
+		}
+		sections[group] = append(sections[group], name)
+		if len(group) > 0 {
+			groups[group] = true
+		}
+	}
+	first := true
+	for _, group := range append([]string{""}, sortedGroups(groups)...) {
+		if len(sections[group]) == 0 {
+			continue
+		}
+		if !first {
+			fmt.Fprintln(w)
+		}
+		if len(group) > 0 {
+			heading = group + ":"
+		}
+		fmt.Fprintln(w, heading)
+		fmt.Fprintln(w)
+		flagUsage(w, sections[group])
+		first = false
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestGroups(t *testing.T) {
+	Convey("Given commands and flags in groups", t, func() {
+		ResetState()
+		Add(&Command{Name: "zap", Short: "Zaps"})
+		Add(&Command{Name: "run", Short: "Runs", Group: "Container Commands"})
+		Add(&Command{Name: "image", Short: "Manages images", Group: "Management Commands"})
+		Add(&Command{Name: "build", Short: "Builds", Group: "Container Commands"})
+		Add(&Command{Name: "network", Short: "Manages networks", Group: "Management Commands"})
+		Add(&Command{Name: "ls", Parent: "network", Short: "Lists networks"})
+		Add(&Command{Name: "create", Parent: "network", Short: "Creates a network", Group: "Changes"})
+		flag.String("host", "", "The host")
+		flag.Int("port", 80, "The port")
+		flag.Bool("debug", false, "Debug mode")
+		So(FlagGroup("Network Flags", "host", "port"), ShouldBeNil)
+		usage := func() string {
+			var buf bytes.Buffer
+			applicationUsage(&buf)
+			return buf.String()
+		}
+
+		Convey("the help should list ungrouped items first, then the groups alphabetically", func() {
+			So(usage(), ShouldContainSubstring, `Available commands:
+
+zap      Zaps
+
+Container Commands:
+
+build    Builds
+run      Runs
+
+Management Commands:
+
+image    Manages images
+network  Manages networks
+
+Available global flags:
+
+    --debug=false  Debug mode [$START_DEBUG]
+
+Network Flags:
+
+    --host=    The host [$START_HOST]
+    --port=80  The port [$START_PORT]
+`)
+		})
+
+		Convey("SetGroupOrder should put the given groups first", func() {
+			SetGroupOrder("Management Commands")
+			So(usage(), ShouldContainSubstring, `image    Manages images
+network  Manages networks
+
+Container Commands:
+`)
+		})
+
+		Convey("KeepCommandOrder should list the commands in the order of registration", func() {
+			KeepCommandOrder()
+			So(usage(), ShouldContainSubstring, `Container Commands:
+
+run      Runs
+build    Builds
+`)
+		})
+
+		Convey("subcommands should be grouped, too", func() {
+			var buf bytes.Buffer
+			So(commandUsage(&buf, Commands["network"]), ShouldBeNil)
+			So(buf.String(), ShouldEndWith, `Available subcommands:
+
+ls      Lists networks
+
+Changes:
+
+create  Creates a network
+`)
+		})
+
+		Convey("FlagGroup should fail for unknown flags", func() {
+			So(FlagGroup("Other", "nonexistent"), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			ResetState()
+		})
+	})
+
+	Convey("The group tag should assign a bound flag to a group", t, func() {
+		ResetState()
+		var opts struct {
+			Host string `group:"Network Flags"`
+		}
+		_, err := BindFlags(&opts)
+		So(err, ShouldBeNil)
+		So(flagGroup(flag.Lookup("host")), ShouldEqual, "Network Flags")
+		ResetState()
+	})
+}
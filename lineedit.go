@@ -0,0 +1,361 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// maxHistory is the number of lines that the shell history keeps.
+const maxHistory = 1000
+
+// Keys that the line editor handles.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLF        = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCR        = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// lineReader reads the lines that the user enters in the shell.
+type lineReader interface {
+	// readLine prints the prompt and returns the next line, or io.EOF at
+	// the end of the input.
+	readLine(prompt string) (string, error)
+	// addHistory adds a line to the history.
+	addHistory(line string, persist bool)
+}
+
+// plainReader reads lines without editing, for input that does not come
+// from a terminal. It prints no prompts.
+type plainReader struct {
+	in *bufio.Reader
+}
+
+func (r *plainReader) readLine(prompt string) (string, error) {
+	line, err := r.in.ReadString('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (r *plainReader) addHistory(line string, persist bool) {}
+
+// lineEditor reads lines from a terminal in raw mode. It supports cursor
+// movement, the common Emacs-style control keys, a history, and completion.
+// Raw mode leaves output processing on, so "\n" starts a new line.
+type lineEditor struct {
+	in          *bufio.Reader
+	out         io.Writer
+	raw         func() (restore func() error, err error)
+	complete    func(line string) []string // candidates for the last word of line
+	history     []string
+	historyPath string // file that persists the history, if not empty
+
+	// state of the line being edited:
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+// newLineEditor returns a line editor for terminal f, with the history
+// from the user's state dir. f must be defaultStdin(), as the line editor
+// reads through bufferedStdin().
+func newLineEditor(f *os.File, out io.Writer) *lineEditor {
+	e := &lineEditor{
+		in:  bufferedStdin(),
+		out: out,
+		raw: func() (func() error, error) {
+			return makeRaw(f)
+		},
+		complete: completions,
+	}
+	if dir, _ := GetUserStateDir(); len(dir) > 0 {
+		e.historyPath = filepath.Join(dir, "history")
+		e.loadHistory()
+	}
+	return e
+}
+
+// readLine switches the terminal to raw mode while the user edits the line.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := e.raw()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	e.prompt = prompt
+	e.buf = nil
+	e.pos = 0
+	hist := len(e.history) // index of the history entry on display
+	edited := ""           // the new line while browsing the history
+	e.refresh()
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case keyCR, keyLF:
+			fmt.Fprint(e.out, "\n")
+			return string(e.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\n")
+			return "", nil
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				fmt.Fprint(e.out, "\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.pos)
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.buf)
+		case keyCtrlB:
+			e.moveBy(-1)
+		case keyCtrlF:
+			e.moveBy(1)
+		case keyBackspace, keyCtrlH:
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+		case keyCtrlU:
+			e.buf = e.buf[e.pos:]
+			e.pos = 0
+		case keyCtrlW:
+			start := e.wordStart()
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyCtrlP, keyCtrlN:
+			hist, edited = e.browse(r == keyCtrlP, hist, edited)
+		case keyTab:
+			e.completeWord()
+		case keyEscape:
+			switch e.readEscape() {
+			case "A":
+				hist, edited = e.browse(true, hist, edited)
+			case "B":
+				hist, edited = e.browse(false, hist, edited)
+			case "C":
+				e.moveBy(1)
+			case "D":
+				e.moveBy(-1)
+			case "H", "1~", "7~":
+				e.pos = 0
+			case "F", "4~", "8~":
+				e.pos = len(e.buf)
+			case "3~":
+				e.deleteAt(e.pos)
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.insert(string(r))
+			}
+		}
+		e.refresh()
+	}
+}
+
+// refresh redraws the prompt and the line, and places the cursor.
+func (e *lineEditor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+	if n := len(e.buf) - e.pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
+
+// readEscape reads the rest of an escape sequence and returns its
+// parameters and final character, for example "A" for "ESC [ A".
+func (e *lineEditor) readEscape() string {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return ""
+	}
+	var seq []rune
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, r)
+		if r >= 0x40 && r <= 0x7e { // final byte
+			return string(seq)
+		}
+	}
+}
+
+// insert inserts s at the cursor.
+func (e *lineEditor) insert(s string) {
+	rs := []rune(s)
+	buf := make([]rune, 0, len(e.buf)+len(rs))
+	buf = append(buf, e.buf[:e.pos]...)
+	buf = append(buf, rs...)
+	e.buf = append(buf, e.buf[e.pos:]...)
+	e.pos += len(rs)
+}
+
+// deleteAt deletes the rune at index i, if any.
+func (e *lineEditor) deleteAt(i int) {
+	if i < len(e.buf) {
+		e.buf = append(e.buf[:i], e.buf[i+1:]...)
+	}
+}
+
+// moveBy moves the cursor by n runes within the line.
+func (e *lineEditor) moveBy(n int) {
+	e.pos += n
+	if e.pos < 0 {
+		e.pos = 0
+	}
+	if e.pos > len(e.buf) {
+		e.pos = len(e.buf)
+	}
+}
+
+// wordStart returns the index where the word before the cursor starts.
+func (e *lineEditor) wordStart() int {
+	i := e.pos
+	for i > 0 && unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// browse shows the previous (back is true) or next history entry, and
+// returns the new history index. edited keeps the line that the user was
+// editing before browsing the history.
+func (e *lineEditor) browse(back bool, hist int, edited string) (int, string) {
+	if hist == len(e.history) {
+		edited = string(e.buf)
+	}
+	switch {
+	case back && hist > 0:
+		hist--
+	case !back && hist < len(e.history):
+		hist++
+	default:
+		return hist, edited
+	}
+	line := edited
+	if hist < len(e.history) {
+		line = e.history[hist]
+	}
+	e.buf = []rune(line)
+	e.pos = len(e.buf)
+	return hist, edited
+}
+
+// completeWord completes the word before the cursor. If there are several
+// candidates, it completes their common prefix, or lists them if the
+// prefix is complete already.
+func (e *lineEditor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	word := string(e.buf[e.wordStart():e.pos])
+	if strings.TrimSpace(word) != word { // cursor after white space
+		word = ""
+	}
+	candidates := e.complete(string(e.buf[:e.pos]))
+	if len(candidates) == 0 {
+		return
+	}
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		prefix += " "
+	}
+	if len(prefix) > len(word) {
+		e.insert(prefix[len(word):])
+		return
+	}
+	fmt.Fprint(e.out, "\n"+strings.Join(candidates, "  ")+"\n")
+}
+
+// commonPrefix returns the longest common prefix of words.
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// addHistory adds line to the history, unless it repeats the previous
+// line. If persist is true, addHistory also appends the line to the
+// history file.
+func (e *lineEditor) addHistory(line string, persist bool) {
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	if !persist || len(e.historyPath) == 0 {
+		return
+	}
+	err := os.MkdirAll(filepath.Dir(e.historyPath), 0o700)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(e.historyPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// loadHistory reads the most recent lines of the history file.
+func (e *lineEditor) loadHistory() {
+	data, err := os.ReadFile(e.historyPath)
+	if err != nil {
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+	}
+	for _, line := range lines {
+		if len(line) > 0 {
+			e.history = append(e.history, line)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLineEditor(t *testing.T) {
+	Convey("Given a line editor", t, func() {
+		var out bytes.Buffer
+		rawCalls := 0
+		e := &lineEditor{
+			out: &out,
+			raw: func() (func() error, error) {
+				rawCalls++
+				return func() error { return nil }, nil
+			},
+			complete: func(line string) []string {
+				var matches []string
+				for _, c := range []string{"help", "hello", "version"} {
+					if strings.HasPrefix(c, line) {
+						matches = append(matches, c)
+					}
+				}
+				return matches
+			},
+		}
+		keys := func(s string) {
+			e.in = bufio.NewReader(strings.NewReader(s))
+		}
+
+		Convey("typed text should end at Enter", func() {
+			keys("greet Joe\r")
+			line, err := e.readLine("> ")
+			So(err, ShouldBeNil)
+			So(line, ShouldEqual, "greet Joe")
+			So(rawCalls, ShouldEqual, 1)
+		})
+
+		Convey("editing keys should change the line", func() {
+			keys("greet Jo\x7fim\x1b[D\x1b[D\x1b[3~X\x01>\x05<\r")
+			line, _ := e.readLine("> ")
+			So(line, ShouldEqual, ">greet JXm<")
+		})
+
+		Convey("Ctrl-W and Ctrl-U should delete words and lines", func() {
+			keys("greet Joe\x17Ann\r")
+			line, _ := e.readLine("> ")
+			So(line, ShouldEqual, "greet Ann")
+			keys("greet Joe\x15help\r")
+			line, _ = e.readLine("> ")
+			So(line, ShouldEqual, "help")
+		})
+
+		Convey("Tab should complete the word", func() {
+			keys("v\t\r")
+			line, _ := e.readLine("> ")
+			So(line, ShouldEqual, "version ")
+			keys("h\t\r")
+			line, _ = e.readLine("> ")
+			So(line, ShouldEqual, "hel")
+		})
+
+		Convey("Tab should list ambiguous candidates", func() {
+			keys("hel\t\r")
+			e.readLine("> ")
+			So(out.String(), ShouldContainSubstring, "help  hello")
+		})
+
+		Convey("the arrow keys should browse the history", func() {
+			e.addHistory("first", false)
+			e.addHistory("second", false)
+			e.addHistory("second", false)
+			So(e.history, ShouldResemble, []string{"first", "second"})
+			keys("new\x1b[A\x1b[A\x1b[A\r")
+			line, _ := e.readLine("> ")
+			So(line, ShouldEqual, "first")
+			keys("new\x1b[A\x1b[B\r")
+			line, _ = e.readLine("> ")
+			So(line, ShouldEqual, "new")
+		})
+
+		Convey("Ctrl-C should discard the line", func() {
+			keys("greet\x03")
+			line, err := e.readLine("> ")
+			So(err, ShouldBeNil)
+			So(line, ShouldEqual, "")
+		})
+
+		Convey("Ctrl-D on an empty line should end the input", func() {
+			keys("\x04")
+			_, err := e.readLine("> ")
+			So(err, ShouldEqual, io.EOF)
+		})
+
+		Convey("the history should persist in the history file", func() {
+			e.historyPath = filepath.Join(t.TempDir(), "app", "history")
+			e.addHistory("first", true)
+			e.addHistory("secret", false)
+			e.addHistory("second", true)
+			data, err := os.ReadFile(e.historyPath)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "first\nsecond\n")
+
+			loaded := &lineEditor{historyPath: e.historyPath}
+			loaded.loadHistory()
+			So(loaded.history, ShouldResemble, []string{"first", "second"})
+		})
+	})
+}
@@ -0,0 +1,180 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Names and usage texts of the log flags.
+const (
+	verboseFlagName   = "verbose"
+	quietFlagName     = "quiet"
+	logLevelFlagName  = "log-level"
+	logFormatFlagName = "log-format"
+	logFormatText     = "text"
+	logFormatJSON     = "json"
+	verboseFlagUsage  = "Log debug messages (same as --log-level=debug)"
+	quietFlagUsage    = "Log errors only (same as --log-level=error)"
+	logLevelFlagUsage = "Log level: debug, info, warn, or error"
+	logFormatUsage    = "Log format: text or json"
+)
+
+var (
+	logFlagsEnabled    bool
+	verboseFlagValue   bool
+	quietFlagValue     bool
+	logLevelFlagValue  string
+	logFormatFlagValue string
+)
+
+// logLevel is the level of all loggers from Command.Logger(). Parse() and
+// config reloads update it, so that loggers that exist already use the new
+// level, too.
+var logLevel = new(slog.LevelVar)
+
+// EnableLogFlags adds the global flags that configure the logger that
+// Command.Logger() returns:
+//
+//	--verbose (-v)  log debug messages
+//	--quiet (-q)    log errors only
+//	--log-level     debug, info (the default), warn, or error
+//	--log-format    text (the default) or json
+//
+// --verbose and --quiet override --log-level and exclude each other.
+// The shorthands -v and -q are only added if the application does not use
+// them already, and flags that the application defines itself are left
+// alone. Like any other flag, the log flags can also be set through
+// environment variables or the config file. With --verbose, Parse() logs
+// the config files that it has read.
+// Call EnableLogFlags before Parse() or Up().
+func EnableLogFlags() {
+	logFlagsEnabled = true
+	Validate(logLevelFlagName, checkLogLevel)
+	Validate(logFormatFlagName, checkLogFormat)
+	constraints = append(constraints, func(func(string) bool) []string {
+		if isTrue(verboseFlagName) && isTrue(quietFlagName) {
+			return []string{"Flags --" + verboseFlagName + " and --" + quietFlagName + " are mutually exclusive, but " +
+				sourceList([]string{verboseFlagName, quietFlagName})}
+		}
+		return nil
+	})
+}
+
+// registerLogFlags adds the log flags to the global flags if
+// EnableLogFlags() has been called.
+func registerLogFlags() {
+	if !logFlagsEnabled {
+		return
+	}
+	if flag.Lookup(verboseFlagName) == nil {
+		flag.BoolVarP(&verboseFlagValue, verboseFlagName, freeShorthand("v"), false, verboseFlagUsage)
+	}
+	if flag.Lookup(quietFlagName) == nil {
+		flag.BoolVarP(&quietFlagValue, quietFlagName, freeShorthand("q"), false, quietFlagUsage)
+	}
+	if flag.Lookup(logLevelFlagName) == nil {
+		flag.StringVar(&logLevelFlagValue, logLevelFlagName, "info", logLevelFlagUsage)
+	}
+	if flag.Lookup(logFormatFlagName) == nil {
+		flag.StringVar(&logFormatFlagValue, logFormatFlagName, logFormatText, logFormatUsage)
+	}
+}
+
+// freeShorthand returns shorthand if no flag uses it, or else "".
+func freeShorthand(shorthand string) string {
+	if flag.ShorthandLookup(shorthand) != nil {
+		return ""
+	}
+	return shorthand
+}
+
+// isTrue returns true if the flag with the given name exists and is true.
+func isTrue(name string) bool {
+	f := flag.Lookup(name)
+	return f != nil && f.Value.String() == "true"
+}
+
+// flagValue returns the value of the flag with the given name, or def if
+// there is no such flag.
+func flagValue(name, def string) string {
+	f := flag.Lookup(name)
+	if f == nil {
+		return def
+	}
+	return f.Value.String()
+}
+
+// checkLogLevel returns an error if level is not a valid log level.
+func checkLogLevel(level string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return errors.New("unknown log level " + level + " (use debug, info, warn, or error)")
+	}
+	return nil
+}
+
+// checkLogFormat returns an error if format is not a valid log format.
+func checkLogFormat(format string) error {
+	if format != logFormatText && format != logFormatJSON {
+		return errors.New("unknown log format " + format + " (use text or json)")
+	}
+	return nil
+}
+
+// updateLogLevel sets the log level from the log flags.
+func updateLogLevel() {
+	level := slog.LevelInfo
+	switch {
+	case isTrue(verboseFlagName):
+		level = slog.LevelDebug
+	case isTrue(quietFlagName):
+		level = slog.LevelError
+	default:
+		// checkConstraints has validated the level.
+		level.UnmarshalText([]byte(flagValue(logLevelFlagName, "info")))
+	}
+	logLevel.Set(level)
+}
+
+// newLogger returns a logger that writes to w at the current log level, in
+// the format that --log-format selects.
+func newLogger(w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	if flagValue(logFormatFlagName, logFormatText) == logFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// Logger returns a structured logger that writes to the command's Stderr
+// (see SetStreams()). The log flags (see EnableLogFlags()) set its level
+// and format. Without the log flags, the logger writes text at level info.
+// Use after calling Up() or Parse().
+func (cmd *Command) Logger() *slog.Logger {
+	return newLogger(cmd.stderr())
+}
+
+// logConfigFiles logs the config files that have been read, at level debug.
+func logConfigFiles(verb string) {
+	if !logFlagsEnabled {
+		return
+	}
+	log := newLogger(defaultStderr())
+	paths := cfgFile.Paths()
+	if len(paths) == 0 {
+		log.Debug("No config file")
+	}
+	for _, path := range paths {
+		log.Debug(verb+" config file", "path", path)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestLogFlags(t *testing.T) {
+	Convey("Given the log flags", t, func() {
+		oldArgs := os.Args
+		ResetState()
+		EnableLogFlags()
+		env := map[string]string{}
+		SetEnvLookup(mapEnv(env))
+		var stderr bytes.Buffer
+		SetStreams(nil, nil, &stderr)
+		parse := func(args ...string) error {
+			os.Args = append([]string{os.Args[0]}, args...)
+			return Parse()
+		}
+
+		Convey("the default level should be info", func() {
+			So(parse(), ShouldBeNil)
+			So(logLevel.Level(), ShouldEqual, slog.LevelInfo)
+			So(flag.Lookup("verbose").Shorthand, ShouldEqual, "v")
+			So(flag.Lookup("quiet").Shorthand, ShouldEqual, "q")
+		})
+
+		Convey("-v should select debug", func() {
+			So(parse("-v"), ShouldBeNil)
+			So(logLevel.Level(), ShouldEqual, slog.LevelDebug)
+		})
+
+		Convey("--quiet should select error", func() {
+			So(parse("--quiet"), ShouldBeNil)
+			So(logLevel.Level(), ShouldEqual, slog.LevelError)
+		})
+
+		Convey("the environment should set the log level", func() {
+			env["START_LOG_LEVEL"] = "warn"
+			So(parse(), ShouldBeNil)
+			So(logLevel.Level(), ShouldEqual, slog.LevelWarn)
+		})
+
+		Convey("--verbose and --quiet should exclude each other", func() {
+			err := parse("-v", "-q")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "mutually exclusive")
+		})
+
+		Convey("--verbose=false and --quiet should not conflict", func() {
+			So(parse("--verbose=false", "-q"), ShouldBeNil)
+		})
+
+		Convey("invalid levels and formats should be errors", func() {
+			err := parse("--log-level=loud", "--log-format=xml")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unknown log level loud")
+			So(err.Error(), ShouldContainSubstring, "unknown log format xml")
+		})
+
+		Convey("Logger should write to the command's Stderr in the selected format", func() {
+			So(parse("--log-format=json", "--log-level=warn"), ShouldBeNil)
+			var buf bytes.Buffer
+			log := (&Command{Stderr: &buf}).Logger()
+			log.Info("hidden")
+			log.Warn("shown", "n", 1)
+			So(buf.String(), ShouldStartWith, `{"time":`)
+			So(buf.String(), ShouldContainSubstring, `"level":"WARN","msg":"shown","n":1}`)
+			So(buf.String(), ShouldNotContainSubstring, "hidden")
+		})
+
+		Convey("--verbose should log the config file", func() {
+			SetFileSystem(fstest.MapFS{"start.toml": {Data: []byte("")}})
+			So(parse("-v"), ShouldBeNil)
+			So(stderr.String(), ShouldContainSubstring, `level=DEBUG msg="Read config file" path=/start.toml`)
+		})
+
+		Convey("an application flag should keep its shorthand", func() {
+			flag.BoolP("vacuum", "v", false, "")
+			So(parse(), ShouldBeNil)
+			So(flag.Lookup("verbose").Shorthand, ShouldEqual, "")
+		})
+
+		Reset(func() {
+			os.Args = oldArgs
+			ResetState()
+		})
+	})
+
+	Convey("Without the log flags, Logger should log at level info", t, func() {
+		ResetState()
+		var buf bytes.Buffer
+		log := (&Command{Stderr: &buf}).Logger()
+		log.Debug("hidden")
+		log.Info("shown")
+		So(buf.String(), ShouldContainSubstring, "level=INFO msg=shown")
+		So(buf.String(), ShouldNotContainSubstring, "hidden")
+	})
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// middlewares is the list of middleware registered via Use(),
+// in the order of registration.
+var middlewares []Middleware
+
+// Use adds middleware that Up() wraps around the command it executes.
+// The first middleware added is the outermost one; that is, it gets called
+// first and returns last. Middleware wraps the command's Cmd or RunE function
+// only; pre-run and post-run hooks run outside the middleware chain.
+//
+//	start.Use(start.Recover(), start.Timing(log.Printf))
+func Use(mw ...Middleware) {
+	middlewares = append(middlewares, mw...)
+}
+
+// chain wraps f into all registered middleware.
+func chain(f CmdFunc) CmdFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		f = middlewares[i](f)
+	}
+	return f
+}
+
+// Recover returns a middleware that turns a panic inside a command into an
+// error. The error message contains the panic value and the stack trace.
+func Recover() Middleware {
+	return func(next CmdFunc) CmdFunc {
+		return func(ctx context.Context, cmd *Command) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("command %s panicked: %v\n%s", cmd.Name, r, debug.Stack())
+				}
+			}()
+			return next(ctx, cmd)
+		}
+	}
+}
+
+// Timing returns a middleware that logs the execution time of a command
+// through logf. If logf is nil, Timing uses log.Printf.
+func Timing(logf func(format string, args ...interface{})) Middleware {
+	if logf == nil {
+		logf = log.Printf
+	}
+	return func(next CmdFunc) CmdFunc {
+		return func(ctx context.Context, cmd *Command) error {
+			begin := time.Now()
+			err := next(ctx, cmd)
+			if err != nil {
+				logf("command %s failed after %v", cmd.Name, time.Since(begin))
+			} else {
+				logf("command %s finished after %v", cmd.Name, time.Since(begin))
+			}
+			return err
+		}
+	}
+}
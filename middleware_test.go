@@ -0,0 +1,103 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMiddleware(t *testing.T) {
+	Convey("Given some middleware", t, func() {
+		var calls []string
+		trace := func(name string) Middleware {
+			return func(next CmdFunc) CmdFunc {
+				return func(ctx context.Context, cmd *Command) error {
+					calls = append(calls, name+" before")
+					err := next(ctx, cmd)
+					calls = append(calls, name+" after")
+					return err
+				}
+			}
+		}
+		Use(trace("outer"), trace("inner"))
+		cmd := &Command{
+			Name: "mwcmd",
+			PreRun: func(cmd *Command) error {
+				calls = append(calls, "prerun")
+				return nil
+			},
+			Cmd: func(cmd *Command) error {
+				calls = append(calls, "cmd")
+				return nil
+			},
+		}
+
+		Convey("the middleware should wrap the command in the order of registration", func() {
+			So(cmd.execute(context.Background()), ShouldBeNil)
+			So(calls, ShouldResemble, []string{
+				"prerun",
+				"outer before",
+				"inner before",
+				"cmd",
+				"inner after",
+				"outer after",
+			})
+		})
+
+		Reset(func() {
+			middlewares = nil
+		})
+	})
+
+	Convey("Given the Recover middleware", t, func() {
+		Use(Recover())
+		cmd := &Command{
+			Name: "panicky",
+			Cmd: func(cmd *Command) error {
+				panic("something went wrong")
+			},
+		}
+
+		Convey("a panic should turn into an error containing the stack trace", func() {
+			err := cmd.execute(context.Background())
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "command panicky panicked: something went wrong")
+			So(err.Error(), ShouldContainSubstring, "goroutine")
+		})
+
+		Reset(func() {
+			middlewares = nil
+		})
+	})
+
+	Convey("Given the Timing middleware", t, func() {
+		var logged string
+		Use(Timing(func(format string, args ...interface{}) {
+			logged = fmt.Sprintf(format, args...)
+		}))
+		cmd := &Command{
+			Name: "timed",
+			Cmd: func(cmd *Command) error {
+				return nil
+			},
+		}
+
+		Convey("the execution time should get logged", func() {
+			So(cmd.execute(context.Background()), ShouldBeNil)
+			So(logged, ShouldStartWith, "command timed finished after ")
+		})
+
+		Reset(func() {
+			middlewares = nil
+		})
+	})
+}
@@ -0,0 +1,373 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Output formats for Print().
+const (
+	outputFlagName  = "output"
+	outputTable     = "table"
+	outputJSON      = "json"
+	outputYAML      = "yaml"
+	templatePrefix  = "template="
+	outputFlagUsage = "Output format: table, json, yaml, or template=<Go template>"
+)
+
+var (
+	outputEnabled   bool
+	outputFlagValue string
+)
+
+// EnableOutputFlag adds the global flag --output (-o, unless the application
+// uses this shorthand already), which selects the format of Command.Print():
+//
+//	table               aligned columns with a header line (the default)
+//	json                indented JSON
+//	yaml                YAML
+//	template=<template> a Go template (text/template), applied to each
+//	                    element of a slice, or to the value itself
+//
+// Like any other flag, --output can also be set through the environment
+// variable <PREFIX>_OUTPUT or the config file key "output".
+// Call EnableOutputFlag before Parse() or Up().
+func EnableOutputFlag() {
+	outputEnabled = true
+	Validate(outputFlagName, checkOutputFormat)
+}
+
+// registerOutputFlag adds --output to the global flags if EnableOutputFlag()
+// has been called, unless the application has defined this flag.
+func registerOutputFlag() {
+	if !outputEnabled || flag.Lookup(outputFlagName) != nil {
+		return
+	}
+	flag.StringVarP(&outputFlagValue, outputFlagName, freeShorthand("o"), outputTable, outputFlagUsage)
+}
+
+// outputFormat returns the value of --output, or "table" if there is no
+// such flag.
+func outputFormat() string {
+	f := flag.Lookup(outputFlagName)
+	if f == nil {
+		return outputTable
+	}
+	return f.Value.String()
+}
+
+// checkOutputFormat returns an error if format is not a valid output format.
+func checkOutputFormat(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	}
+	if strings.HasPrefix(format, templatePrefix) {
+		_, err := template.New(outputFlagName).Parse(strings.TrimPrefix(format, templatePrefix))
+		return err
+	}
+	return errors.New("unknown output format " + format + " (use table, json, yaml, or template=<template>)")
+}
+
+// Print writes v to the command's Stdout in the format that the flag --output selects
+// (see EnableOutputFlag()). v can be a struct, a map, a slice of structs or
+// maps, or a scalar value. Field names and the order of the fields follow
+// the encoding/json rules, so `json` struct tags apply to all formats.
+// In tables, each struct or map is a row, and each field or key is a
+// column. Nested values appear as compact JSON.
+func (cmd *Command) Print(v interface{}) error {
+	return render(cmd.stdout(), outputFormat(), v)
+}
+
+// render writes v to w in the given format.
+func render(w io.Writer, format string, v interface{}) error {
+	if err := checkOutputFormat(format); err != nil {
+		return errors.New("Print: " + err.Error())
+	}
+	if strings.HasPrefix(format, templatePrefix) {
+		return renderTemplate(w, strings.TrimPrefix(format, templatePrefix), v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.New("Print: " + err.Error())
+	}
+	if format == outputJSON {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "  "); err != nil {
+			return errors.New("Print: " + err.Error())
+		}
+		buf.WriteString("\n")
+		_, err = buf.WriteTo(w)
+		return err
+	}
+	n, err := decodeNode(json.NewDecoder(bytes.NewReader(data)))
+	if err != nil {
+		return errors.New("Print: " + err.Error())
+	}
+	if format == outputYAML {
+		var buf bytes.Buffer
+		writeYAML(&buf, n, 0)
+		_, err = buf.WriteTo(w)
+		return err
+	}
+	return writeTable(w, n)
+}
+
+// renderTemplate applies the template to each element of v, if v is a
+// slice or an array, or else to v. Each result ends with a line break.
+func renderTemplate(w io.Writer, text string, v interface{}) error {
+	tmpl, err := template.New(outputFlagName).Parse(text)
+	if err != nil {
+		return errors.New("Print: " + err.Error())
+	}
+	items := []interface{}{v}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		items = items[:0]
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, rv.Index(i).Interface())
+		}
+	}
+	for _, item := range items {
+		if err := tmpl.Execute(w, item); err != nil {
+			return errors.New("Print: " + err.Error())
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// Kinds of nodes.
+const (
+	nodeScalar = iota
+	nodeObject
+	nodeArray
+)
+
+// node is a JSON value that keeps the order of object keys.
+type node struct {
+	kind   int
+	scalar interface{} // string, json.Number, bool, or nil
+	keys   []string    // keys of an object
+	items  []*node     // values of an object's keys, or elements of an array
+}
+
+// decodeNode reads the next JSON value from dec.
+func decodeNode(dec *json.Decoder) (*node, error) {
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		n := &node{kind: nodeObject}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			item, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.keys = append(n.keys, key.(string))
+			n.items = append(n.items, item)
+		}
+		_, err = dec.Token() // '}'
+		return n, err
+	case json.Delim('['):
+		n := &node{kind: nodeArray}
+		for dec.More() {
+			item, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, item)
+		}
+		_, err = dec.Token() // ']'
+		return n, err
+	}
+	return &node{kind: nodeScalar, scalar: tok}, nil
+}
+
+// text returns the node as table cell: strings without quotes, null as an
+// empty string, and objects and arrays as compact JSON.
+func (n *node) text() string {
+	switch n.kind {
+	case nodeScalar:
+		switch s := n.scalar.(type) {
+		case nil:
+			return ""
+		case string:
+			return s
+		default:
+			return fmt.Sprint(s)
+		}
+	}
+	var buf bytes.Buffer
+	n.writeJSON(&buf)
+	return buf.String()
+}
+
+// writeJSON writes the node as compact JSON.
+func (n *node) writeJSON(buf *bytes.Buffer) {
+	switch n.kind {
+	case nodeObject:
+		buf.WriteString("{")
+		for i, key := range n.keys {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			data, _ := json.Marshal(key)
+			buf.Write(data)
+			buf.WriteString(":")
+			n.items[i].writeJSON(buf)
+		}
+		buf.WriteString("}")
+	case nodeArray:
+		buf.WriteString("[")
+		for i, item := range n.items {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			item.writeJSON(buf)
+		}
+		buf.WriteString("]")
+	default:
+		data, _ := json.Marshal(n.scalar)
+		buf.Write(data)
+	}
+}
+
+// writeTable writes objects as rows of a table, with the keys as column
+// headers. Arrays of scalars and scalars are written one per line.
+func writeTable(w io.Writer, n *node) error {
+	rows := []*node{n}
+	if n.kind == nodeArray {
+		rows = n.items
+	}
+	var columns []string
+	seen := map[string]bool{}
+	for _, row := range rows {
+		for _, key := range row.keys {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	if len(columns) == 0 { // no objects
+		for _, row := range rows {
+			if _, err := fmt.Fprintln(w, row.text()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = strings.ToUpper(column)
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			for j, key := range row.keys {
+				if key == column {
+					cells[i] = row.items[j].text()
+				}
+			}
+		}
+		if row.kind != nodeObject {
+			cells[0] = row.text()
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeYAML writes the node as YAML, indented by indent spaces.
+func writeYAML(buf *bytes.Buffer, n *node, indent int) {
+	prefix := strings.Repeat(" ", indent)
+	switch {
+	case n.kind == nodeObject && len(n.keys) > 0:
+		for i, key := range n.keys {
+			buf.WriteString(prefix + yamlString(key) + ":")
+			writeYAMLValue(buf, n.items[i], indent+2)
+		}
+	case n.kind == nodeArray && len(n.items) > 0:
+		for _, item := range n.items {
+			buf.WriteString(prefix + "-")
+			writeYAMLValue(buf, item, indent+2)
+		}
+	default:
+		buf.WriteString(prefix + yamlScalar(n) + "\n")
+	}
+}
+
+// writeYAMLValue writes the value after a key or a dash: scalars and empty
+// collections on the same line, other values indented on the next lines.
+func writeYAMLValue(buf *bytes.Buffer, n *node, indent int) {
+	if (n.kind == nodeObject && len(n.keys) > 0) || (n.kind == nodeArray && len(n.items) > 0) {
+		buf.WriteString("\n")
+		writeYAML(buf, n, indent)
+		return
+	}
+	buf.WriteString(" " + yamlScalar(n) + "\n")
+}
+
+// yamlScalar returns a scalar or an empty collection in YAML syntax.
+func yamlScalar(n *node) string {
+	switch n.kind {
+	case nodeObject:
+		return "{}"
+	case nodeArray:
+		return "[]"
+	}
+	switch s := n.scalar.(type) {
+	case nil:
+		return "null"
+	case string:
+		return yamlString(s)
+	default:
+		return fmt.Sprint(s)
+	}
+}
+
+// yamlString returns s as a plain YAML scalar if that is unambiguous, or
+// else as a double-quoted string.
+func yamlString(s string) string {
+	if len(s) == 0 || strings.TrimSpace(s) != s ||
+		strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(s, ": ") || strings.HasSuffix(s, ":") || strings.Contains(s, " #") ||
+		strings.ContainsAny(s, "\n\r\t\\") {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~", "y", "n":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	return s
+}
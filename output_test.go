@@ -0,0 +1,141 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+type outputItem struct {
+	Name  string            `json:"name"`
+	Size  int               `json:"size"`
+	Tags  []string          `json:"tags,omitempty"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+func TestRender(t *testing.T) {
+	items := []outputItem{
+		{Name: "alpha", Size: 1, Tags: []string{"a", "b"}},
+		{Name: "beta gamma", Size: 22, Attrs: map[string]string{"k": "v"}},
+	}
+	out := func(format string, v interface{}) string {
+		var buf bytes.Buffer
+		So(render(&buf, format, v), ShouldBeNil)
+		return buf.String()
+	}
+
+	Convey("table should align the fields of each element in columns", t, func() {
+		So(out("table", items), ShouldEqual, `NAME        SIZE  TAGS       ATTRS
+alpha       1     ["a","b"]  
+beta gamma  22               {"k":"v"}
+`)
+		So(out("table", items[0]), ShouldEqual, "NAME   SIZE  TAGS\nalpha  1     [\"a\",\"b\"]\n")
+		So(out("table", []string{"x", "y"}), ShouldEqual, "x\ny\n")
+		So(out("table", 42), ShouldEqual, "42\n")
+	})
+
+	Convey("json should be indented", t, func() {
+		So(out("json", items[0]), ShouldEqual, `{
+  "name": "alpha",
+  "size": 1,
+  "tags": [
+    "a",
+    "b"
+  ]
+}
+`)
+	})
+
+	Convey("yaml should keep the field order and quote ambiguous strings", t, func() {
+		So(out("yaml", items), ShouldEqual, `-
+  name: alpha
+  size: 1
+  tags:
+    - a
+    - b
+-
+  name: beta gamma
+  size: 22
+  attrs:
+    k: v
+`)
+		So(out("yaml", map[string]interface{}{"a": "true", "b": "", "c": "x: y", "d": nil, "e": []int{}, "f": "key:", "g": "x:\ny"}), ShouldEqual, `a: "true"
+b: ""
+c: "x: y"
+d: null
+e: []
+f: "key:"
+g: "x:\ny"
+`)
+	})
+
+	Convey("templates should apply to each element", t, func() {
+		So(out("template={{.Name}} ({{.Size}})", items), ShouldEqual, "alpha (1)\nbeta gamma (22)\n")
+		So(out("template={{.Name}}", items[1]), ShouldEqual, "beta gamma\n")
+	})
+
+	Convey("invalid formats should be errors", t, func() {
+		var buf bytes.Buffer
+		So(render(&buf, "xml", items), ShouldNotBeNil)
+		So(render(&buf, "template={{.Name", items), ShouldNotBeNil)
+		So(render(&buf, "template={{.Missing}}", items), ShouldNotBeNil)
+	})
+}
+
+func TestOutputFlag(t *testing.T) {
+	Convey("Given the output flag", t, func() {
+		oldArgs := os.Args
+		ResetState()
+		EnableOutputFlag()
+		env := map[string]string{}
+		SetEnvLookup(mapEnv(env))
+
+		Convey("--output and -o should select the format", func() {
+			os.Args = []string{os.Args[0], "-o", "json"}
+			So(Parse(), ShouldBeNil)
+			So(outputFormat(), ShouldEqual, "json")
+			So(flag.Lookup("output").Usage, ShouldEqual, outputFlagUsage)
+		})
+
+		Convey("the environment should set the default format", func() {
+			env["START_OUTPUT"] = "yaml"
+			os.Args = []string{os.Args[0]}
+			So(Parse(), ShouldBeNil)
+			So(outputFormat(), ShouldEqual, "yaml")
+		})
+
+		Convey("an unknown format should be an error", func() {
+			os.Args = []string{os.Args[0], "--output=xml"}
+			err := Parse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unknown output format xml")
+		})
+
+		Convey("an application flag named -o should keep its shorthand", func() {
+			flag.StringP("outfile", "o", "", "")
+			os.Args = []string{os.Args[0]}
+			So(Parse(), ShouldBeNil)
+			So(flag.Lookup("output").Shorthand, ShouldEqual, "")
+		})
+
+		Reset(func() {
+			os.Args = oldArgs
+			ResetState()
+		})
+	})
+
+	Convey("Without the output flag, the format should be table", t, func() {
+		ResetState()
+		So(outputFormat(), ShouldEqual, "table")
+	})
+}
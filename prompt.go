@@ -0,0 +1,345 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Flag annotations for prompting.
+const (
+	promptAnnotation  = "start_prompt"
+	choicesAnnotation = "start_choices"
+)
+
+// promptSource is the source of values that the user has entered at a prompt.
+const promptSource = "prompt"
+
+// terminal is where prompts are written to and answers are read from.
+type terminal struct {
+	in      *bufio.Reader
+	out     io.Writer
+	setEcho func(on bool) error // turns echoing the input on or off
+}
+
+// openTerminal returns the terminal for prompts, or nil if stdin is not a
+// terminal.
+var openTerminal = func() *terminal {
+	f, isFile := defaultStdin().(*os.File)
+	if !isFile || !isTerminal(f) {
+		return nil
+	}
+	return &terminal{
+		in:  bufferedStdin(),
+		out: defaultStderr(),
+		setEcho: func(on bool) error {
+			return setEcho(f, on)
+		},
+	}
+}
+
+// Prompt marks the flags with the given names for prompting: If neither the
+// command line, nor an environment variable, nor the config file sets such
+// a flag, Parse() asks the user for the value, provided that stdin is a
+// terminal. Otherwise, Parse() fails with an error that lists the missing
+// flags along with the ways to set them.
+// The prompt shows the flag's usage text and default value. Pressing Enter
+// accepts the default value, if it is not empty. Secret flags (see
+// Secret()) do not echo the input; this requires Linux, macOS, or BSD, and
+// fails on other operating systems. Bool flags ask for confirmation (y/n),
+// and flags with choices (see Choices()) offer a numbered list.
+// Parse() only prompts for global flags and for flags of the command on the
+// command line, and never for the "help" and "version" commands.
+// Call Prompt after defining the flags and before Parse() or Up().
+// For flags defined through BindFlags(), use the tag `prompt:"true"`.
+func Prompt(names ...string) error {
+	for _, name := range names {
+		err := flag.CommandLine.SetAnnotation(name, promptAnnotation, []string{"true"})
+		if err != nil {
+			return errors.New("Prompt: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Choices restricts the values of the flag with the given name to the given
+// choices. Parse() reports values from any source that are not among the
+// choices, and prompts (see Prompt()) offer the choices as a list.
+// Call Choices after defining the flag and before Parse() or Up().
+// For flags defined through BindFlags(), use the tag `choices:"a,b,c"`.
+func Choices(name string, choices ...string) error {
+	err := flag.CommandLine.SetAnnotation(name, choicesAnnotation, choices)
+	if err != nil {
+		return errors.New("Choices: " + err.Error())
+	}
+	constraints = append(constraints, func(active func(string) bool) []string {
+		f := flag.Lookup(name)
+		if f == nil || !active(name) || !isSet(name) || isChoice(f, f.Value.String()) {
+			return nil
+		}
+		return []string{"Invalid value for flag --" + name + " (" + flagSource(name) + "): must be one of " + strings.Join(choices, ", ")}
+	})
+	return nil
+}
+
+// isPrompted returns true if flag f is marked for prompting.
+func isPrompted(f *flag.Flag) bool {
+	_, ok := f.Annotations[promptAnnotation]
+	return ok
+}
+
+// isChoice returns true if value is one of the choices of flag f, or if f
+// has no choices.
+func isChoice(f *flag.Flag, value string) bool {
+	choices, ok := f.Annotations[choicesAnnotation]
+	if !ok {
+		return true
+	}
+	for _, choice := range choices {
+		if value == choice {
+			return true
+		}
+	}
+	return false
+}
+
+// promptMissing asks the user for the values of all flags that are marked
+// for prompting but have not been set by any source.
+func promptMissing() error {
+	args := commandArgs()
+	if len(args) > 0 && (args[0] == "help" || args[0] == "version") {
+		return nil
+	}
+	active := activeFlags(args)
+	var missing []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		if isPrompted(f) && !isSet(f.Name) && active(f.Name) {
+			missing = append(missing, f)
+		}
+	})
+	if len(missing) == 0 {
+		return nil
+	}
+	term := openTerminal()
+	if term == nil {
+		var msgs []string
+		for _, f := range missing {
+			msgs = append(msgs, "Missing value for flag --"+f.Name+" (or "+flagAlternatives(f)+"); cannot prompt for it, as stdin is not a terminal")
+		}
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	for _, f := range missing {
+		if err := term.ask(f); err != nil {
+			return err
+		}
+		flagSources[f.Name] = promptSource
+	}
+	return nil
+}
+
+// activeFlags returns a function that reports whether the flag with the
+// given name applies to the command that args select: either the flag is
+// global, or it belongs to that command or subcommand.
+func activeFlags(args []string) func(name string) bool {
+	relevant := commandFlagNames(args)
+	return func(name string) bool {
+		return !privateFlags[name] || relevant[name]
+	}
+}
+
+// commandFlagNames returns the names of the flags of the command and the
+// subcommand that args select.
+func commandFlagNames(args []string) map[string]bool {
+	names := map[string]bool{}
+	if len(args) == 0 {
+		return names
+	}
+	cmd, ok := Commands[args[0]]
+	if !ok {
+		return names
+	}
+	for _, name := range cmd.Flags {
+		names[name] = true
+	}
+	if len(args) > 1 {
+		if subcmd, ok := cmd.children[args[1]]; ok {
+			for _, name := range subcmd.Flags {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
+
+// ask prompts for the value of flag f until the user enters a valid value.
+func (t *terminal) ask(f *flag.Flag) error {
+	label := "--" + f.Name
+	if len(f.Usage) > 0 {
+		label += " (" + f.Usage + ")"
+	}
+	choices := f.Annotations[choicesAnnotation]
+	if len(choices) > 0 {
+		fmt.Fprintln(t.out, "Choose "+label+":")
+		for i, choice := range choices {
+			fmt.Fprintf(t.out, "  %d) %s\n", i+1, choice)
+		}
+	}
+	for {
+		var answer string
+		var err error
+		switch {
+		case f.Value.Type() == "bool":
+			answer, err = t.confirm(label, f.DefValue == "true")
+		case len(choices) > 0:
+			answer, err = t.choose(choices, f.DefValue)
+		case isSecret(f):
+			answer, err = t.readSecret("Enter " + label + ": ")
+		default:
+			answer, err = t.readLine("Enter " + label + defaultHint(f.DefValue) + ": ")
+		}
+		if len(answer) == 0 {
+			answer = strings.TrimSuffix(strings.TrimPrefix(f.DefValue, "["), "]")
+		}
+		if err != nil {
+			return errors.New("Cannot read value for flag --" + f.Name + ": " + err.Error())
+		}
+		if len(answer) == 0 {
+			fmt.Fprintln(t.out, "A value is required.")
+			continue
+		}
+		err = setAnswer(f, answer)
+		if err == nil {
+			return nil
+		}
+		fmt.Fprintln(t.out, "Error: "+invalidValueMsg(f, err))
+	}
+}
+
+// setAnswer sets flag f to the user's answer. Slice flags take a
+// comma-separated list, like in environment variables.
+func setAnswer(f *flag.Flag, answer string) error {
+	if _, isSlice := f.Value.(flag.SliceValue); isSlice {
+		vals, err := splitList(answer)
+		if err != nil {
+			return err
+		}
+		return setList(f, vals)
+	}
+	return setScalar(f, answer)
+}
+
+// confirm asks a yes/no question and returns "true" or "false".
+func (t *terminal) confirm(label string, def bool) (string, error) {
+	hint := " [y/N]: "
+	if def {
+		hint = " [Y/n]: "
+	}
+	for {
+		answer, err := t.readLine(label + "?" + hint)
+		if err != nil {
+			return "", err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return strconv.FormatBool(def), nil
+		case "y", "yes":
+			return "true", nil
+		case "n", "no":
+			return "false", nil
+		}
+		fmt.Fprintln(t.out, "Please answer y or n.")
+	}
+}
+
+// choose asks for one of the choices, either by number or by value.
+func (t *terminal) choose(choices []string, def string) (string, error) {
+	for {
+		answer, err := t.readLine("Enter 1-" + strconv.Itoa(len(choices)) + defaultHint(def) + ": ")
+		if err != nil {
+			return "", err
+		}
+		if len(answer) == 0 {
+			answer = def
+		}
+		if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(choices) {
+			return choices[i-1], nil
+		}
+		for _, choice := range choices {
+			if answer == choice {
+				return choice, nil
+			}
+		}
+		fmt.Fprintln(t.out, "Please enter a number between 1 and "+strconv.Itoa(len(choices))+".")
+	}
+}
+
+// readSecret reads a line without echoing it. If SIGINT or SIGTERM arrives
+// while the user is typing, readSecret turns echoing back on and exits, as
+// the terminal would otherwise remain without echo after the process ends.
+func (t *terminal) readSecret(prompt string) (string, error) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	if err := t.setEcho(false); err != nil {
+		signal.Stop(sigs)
+		return "", err
+	}
+	done := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case sig := <-sigs:
+			t.setEcho(true)
+			fmt.Fprintln(t.out)
+			exit(signalExitCode(sig))
+		case <-done:
+		}
+	}()
+	answer, err := t.readLine(prompt)
+	signal.Stop(sigs)
+	close(done)
+	<-watched
+	fmt.Fprintln(t.out) // the user's Enter was not echoed
+	if echoErr := t.setEcho(true); err == nil {
+		err = echoErr
+	}
+	return answer, err
+}
+
+// readLine prints the prompt and reads a line, without the line break and
+// surrounding white space. At the end of the input, readLine returns an
+// error.
+func (t *terminal) readLine(prompt string) (string, error) {
+	fmt.Fprint(t.out, prompt)
+	line, err := t.in.ReadString('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err == io.EOF {
+		return "", errors.New("end of input")
+	}
+	return strings.TrimSpace(line), err
+}
+
+// defaultHint returns the default value for display in a prompt.
+func defaultHint(def string) string {
+	if len(def) == 0 || def == "[]" {
+		return ""
+	}
+	return " [" + def + "]"
+}
@@ -0,0 +1,40 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package start
+
+import (
+	"errors"
+	"os"
+)
+
+// isTerminal returns true if f is a character device, which usually is a
+// terminal. On this operating system, isTerminal cannot tell a terminal
+// from other character devices like the null device.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// setEcho turns echoing the input of terminal f on or off. On this
+// operating system, setEcho cannot turn off echoing, so prompts for secret
+// flags fail rather than showing the secret.
+func setEcho(f *os.File, on bool) error {
+	if on {
+		return nil
+	}
+	return errors.New("cannot hide the input on this operating system")
+}
+
+// makeRaw puts terminal f into raw mode. On this operating system, makeRaw
+// is not available, so the shell falls back to reading plain lines.
+func makeRaw(f *os.File) (restore func() error, err error) {
+	return nil, errors.New("raw terminal mode is not available on this operating system")
+}
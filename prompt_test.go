@@ -0,0 +1,195 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestPrompt(t *testing.T) {
+	Convey("Given flags marked for prompting", t, func() {
+		oldArgs := os.Args
+		oldOpenTerminal := openTerminal
+		ResetState()
+		name := flag.String("name", "", "Your name")
+		color := flag.String("color", "red", "Favorite color")
+		agree := flag.Bool("agree", false, "Accept the terms")
+		token := flag.String("token", "", "API token")
+		So(Prompt("name", "color", "agree", "token"), ShouldBeNil)
+		So(Choices("color", "red", "green", "blue"), ShouldBeNil)
+		So(Secret("token"), ShouldBeNil)
+		env := map[string]string{}
+		SetEnvLookup(mapEnv(env))
+		os.Args = []string{os.Args[0]}
+
+		var out bytes.Buffer
+		var echo []bool
+		input := func(lines ...string) {
+			openTerminal = func() *terminal {
+				return &terminal{
+					in:  bufio.NewReader(strings.NewReader(strings.Join(lines, "\n") + "\n")),
+					out: &out,
+					setEcho: func(on bool) error {
+						echo = append(echo, on)
+						return nil
+					},
+				}
+			}
+		}
+
+		Convey("Parse should ask for all missing values", func() {
+			input("y", "2", "Joe", "s3cr3t")
+			So(Parse(), ShouldBeNil)
+			So(*name, ShouldEqual, "Joe")
+			So(*color, ShouldEqual, "green")
+			So(*agree, ShouldBeTrue)
+			So(*token, ShouldEqual, "s3cr3t")
+			So(FlagSource("name"), ShouldEqual, "prompt")
+			So(out.String(), ShouldContainSubstring, "Enter --name (Your name): ")
+			So(out.String(), ShouldContainSubstring, "  2) green\n")
+			So(out.String(), ShouldContainSubstring, "--agree (Accept the terms)? [y/N]: ")
+
+			Convey("without echoing secrets", func() {
+				So(echo, ShouldResemble, []bool{false, true})
+				So(out.String(), ShouldNotContainSubstring, "s3cr3t")
+			})
+		})
+
+		Convey("Enter should accept the default value", func() {
+			input("", "", "Joe", "s3cr3t")
+			So(Parse(), ShouldBeNil)
+			So(*color, ShouldEqual, "red")
+			So(*agree, ShouldBeFalse)
+		})
+
+		Convey("invalid answers should be asked again", func() {
+			input("maybe", "n", "7", "blue", "", "Joe", "s3cr3t")
+			So(Parse(), ShouldBeNil)
+			So(*name, ShouldEqual, "Joe")
+			So(*color, ShouldEqual, "blue")
+			So(out.String(), ShouldContainSubstring, "A value is required.")
+			So(out.String(), ShouldContainSubstring, "Please enter a number between 1 and 3.")
+			So(out.String(), ShouldContainSubstring, "Please answer y or n.")
+		})
+
+		Convey("Parse should not ask for values that other sources have set", func() {
+			env["START_NAME"] = "env"
+			env["START_TOKEN"] = "t"
+			input("y", "2")
+			So(Parse(), ShouldBeNil)
+			So(*name, ShouldEqual, "env")
+			So(out.String(), ShouldNotContainSubstring, "--name")
+		})
+
+		Convey("the end of the input should be an error", func() {
+			input("y")
+			err := Parse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Cannot read value for flag --color: end of input")
+		})
+
+		Convey("Parse should not prompt for the help command", func() {
+			openTerminal = func() *terminal { return nil }
+			os.Args = []string{os.Args[0], "help"}
+			So(Parse(), ShouldBeNil)
+		})
+
+		Convey("without a terminal, Parse should list the missing flags", func() {
+			openTerminal = func() *terminal { return nil }
+			env["START_COLOR"] = "blue"
+			err := Parse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Missing value for flag --name (or environment variable START_NAME, or config file key name); cannot prompt for it, as stdin is not a terminal")
+			So(err.Error(), ShouldContainSubstring, "--token")
+			So(err.Error(), ShouldNotContainSubstring, "--color")
+		})
+
+		Convey("Choices should reject other values from any source", func() {
+			env["START_COLOR"] = "purple"
+			input("y", "Joe", "s3cr3t")
+			err := Parse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Invalid value for flag --color (environment variable START_COLOR): must be one of red, green, blue")
+		})
+
+		Reset(func() {
+			os.Args = oldArgs
+			openTerminal = oldOpenTerminal
+			ResetState()
+		})
+	})
+}
+
+func TestReadSecret(t *testing.T) {
+	oldExit := exit
+	defer func() {
+		exit = oldExit
+	}()
+
+	Convey("A signal at a secret prompt should turn echoing back on and exit", t, func() {
+		exitCode := make(chan int, 1)
+		exit = func(code int) { exitCode <- code }
+		in, typed := io.Pipe()
+		echoes := make(chan bool, 3)
+		term := &terminal{
+			in:  bufio.NewReader(in),
+			out: io.Discard,
+			setEcho: func(on bool) error {
+				echoes <- on
+				return nil
+			},
+		}
+		read := make(chan string)
+		go func() {
+			answer, _ := term.readSecret("Enter --token: ")
+			read <- answer
+		}()
+		So(<-echoes, ShouldBeFalse)
+		p, err := os.FindProcess(os.Getpid())
+		So(err, ShouldBeNil)
+		if err := p.Signal(os.Interrupt); err != nil {
+			SkipSo("sending signals is not supported: " + err.Error())
+			return
+		}
+		So(<-exitCode, ShouldEqual, 128+int(syscall.SIGINT))
+		So(<-echoes, ShouldBeTrue)
+		fmt.Fprintln(typed, "s3cr3t")
+		So(<-read, ShouldEqual, "s3cr3t")
+	})
+}
+
+func TestIsTerminal(t *testing.T) {
+	Convey("A regular file should not be a terminal", t, func() {
+		f, err := os.CreateTemp(t.TempDir(), "stdin")
+		So(err, ShouldBeNil)
+		defer f.Close()
+		So(isTerminal(f), ShouldBeFalse)
+	})
+
+	Convey("The null device should not be a terminal", t, func() {
+		if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+			SkipSo("isTerminal cannot tell the null device from a terminal on " + runtime.GOOS)
+			return
+		}
+		f, err := os.Open(os.DevNull)
+		So(err, ShouldBeNil)
+		defer f.Close()
+		So(isTerminal(f), ShouldBeFalse)
+	})
+}
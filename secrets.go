@@ -0,0 +1,136 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// secretAnnotation marks a flag as secret.
+const secretAnnotation = "start_secret"
+
+// redacted replaces the value of secret flags in help output.
+const redacted = "********"
+
+// Prefixes of indirect secret values.
+const (
+	secretFilePrefix = "@file:"
+	secretEnvPrefix  = "env:"
+	secretCmdPrefix  = "cmd:"
+)
+
+// secretCommandsAllowed is true if AllowSecretCommands() has been called.
+var secretCommandsAllowed bool
+
+// Secret marks the flags with the given names as secret.
+// Values of secret flags from the config file or from environment variables
+// can refer to the actual secret instead of containing it:
+//
+//	@file:/run/secrets/token  reads the secret from a file
+//	env:OTHER_VAR             reads the secret from another environment variable
+//	cmd:pass show app/token   runs a command and reads the secret from its output
+//
+// Trailing line breaks are removed from the secret. The command is split
+// at white space and runs without a shell, so quotes and shell syntax are
+// not available. cmd: is disabled unless the application calls
+// AllowSecretCommands().
+// Indirections trust the source of the value: @file: can read any file that
+// the user can read, and cmd: runs any program. A config file that
+// SearchParentDirs() finds in a project directory is as trusted as the
+// user's own config file, even if it comes from a repository that someone
+// else controls.
+// Help output shows secret values as "********", and error messages about
+// secret flags do not contain their values. Custom validators (see
+// Validate()) should not include the value in their errors either.
+// Call Secret after defining the flags and before Parse() or Up().
+// For flags defined through BindFlags(), use the tag `secret:"true"`.
+func Secret(names ...string) error {
+	for _, name := range names {
+		err := flag.CommandLine.SetAnnotation(name, secretAnnotation, []string{"true"})
+		if err != nil {
+			return errors.New("Secret: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// IsSecret returns true if the flag with the given name is secret.
+// Use it to redact values in your own output.
+func IsSecret(name string) bool {
+	f := flag.Lookup(name)
+	return f != nil && isSecret(f)
+}
+
+// isSecret returns true if flag f is secret.
+func isSecret(f *flag.Flag) bool {
+	_, ok := f.Annotations[secretAnnotation]
+	return ok
+}
+
+// displayValue returns the value of flag f for display, redacted if the
+// flag is secret.
+func displayValue(f *flag.Flag) string {
+	value := f.Value.String()
+	if isSecret(f) && len(value) > 0 {
+		return redacted
+	}
+	return value
+}
+
+// AllowSecretCommands enables the cmd: indirection for secret flags (see
+// Secret()). Call it only if all config files that the application reads
+// are trusted, as any of them can then run arbitrary programs.
+func AllowSecretCommands() {
+	secretCommandsAllowed = true
+}
+
+// resolveSecret returns the secret that val refers to, along with a
+// description of where the secret came from. If val has none of the
+// prefixes for indirect values, resolveSecret returns val itself.
+// Errors never contain the secret.
+func resolveSecret(val string) (secret, via string, err error) {
+	switch {
+	case strings.HasPrefix(val, secretFilePrefix):
+		path := strings.TrimPrefix(val, secretFilePrefix)
+		content, err := readFile(path)
+		if err != nil {
+			return "", "", errors.New("cannot read secret: " + err.Error())
+		}
+		return trimLineBreak(string(content)), "file " + path, nil
+	case strings.HasPrefix(val, secretEnvPrefix):
+		name := strings.TrimPrefix(val, secretEnvPrefix)
+		secret := getenv(name)
+		if len(secret) == 0 {
+			return "", "", errors.New("cannot read secret: environment variable " + name + " is not set")
+		}
+		return secret, "environment variable " + name, nil
+	case strings.HasPrefix(val, secretCmdPrefix):
+		if !secretCommandsAllowed {
+			return "", "", errors.New("cannot read secret: " + secretCmdPrefix + " is disabled (see AllowSecretCommands())")
+		}
+		args := strings.Fields(strings.TrimPrefix(val, secretCmdPrefix))
+		if len(args) == 0 {
+			return "", "", errors.New("cannot read secret: no command given")
+		}
+		out, err := exec.Command(args[0], args[1:]...).Output()
+		if err != nil {
+			return "", "", errors.New("cannot read secret from command " + args[0] + ": " + err.Error())
+		}
+		return trimLineBreak(string(out)), "command " + args[0], nil
+	}
+	return val, "", nil
+}
+
+// trimLineBreak removes trailing line breaks.
+func trimLineBreak(s string) string {
+	return strings.TrimRight(s, "\r\n")
+}
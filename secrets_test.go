@@ -0,0 +1,111 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestSecrets(t *testing.T) {
+	Convey("Given secret flags", t, func() {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		os.Args = []string{os.Args[0]}
+		token := flag.String("token", "", "API token")
+		flag.Int("pin", 0, "PIN")
+		plain := flag.String("plain", "", "Not a secret")
+		So(Secret("token", "pin"), ShouldBeNil)
+		files := fstest.MapFS{
+			"run/secrets/token": {Data: []byte("s3cr3t\n")},
+		}
+		SetFileSystem(files)
+		env := map[string]string{}
+		SetEnvLookup(mapEnv(env))
+
+		Convey("@file: should read the secret from a file", func() {
+			files["start.toml"] = &fstest.MapFile{Data: []byte(`token = "@file:/run/secrets/token"`)}
+			So(Reparse(), ShouldBeNil)
+			So(*token, ShouldEqual, "s3cr3t")
+			So(FlagSource("token"), ShouldEqual, "config file "+filepath.FromSlash("/start.toml")+":1 via file /run/secrets/token")
+		})
+
+		Convey("env: should read the secret from another environment variable", func() {
+			env["START_TOKEN"] = "env:OTHER_VAR"
+			env["OTHER_VAR"] = "from other var"
+			So(Reparse(), ShouldBeNil)
+			So(*token, ShouldEqual, "from other var")
+			So(FlagSource("token"), ShouldEqual, "environment variable START_TOKEN via environment variable OTHER_VAR")
+		})
+
+		Convey("cmd: should read the secret from the output of a command", func() {
+			if runtime.GOOS == "windows" {
+				return
+			}
+			AllowSecretCommands()
+			env["START_TOKEN"] = "cmd:echo from command"
+			So(Reparse(), ShouldBeNil)
+			So(*token, ShouldEqual, "from command")
+		})
+
+		Convey("cmd: should be disabled by default", func() {
+			files["start.toml"] = &fstest.MapFile{Data: []byte(`token = "cmd:touch /tmp/start-pwned"`)}
+			err := Reparse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cmd: is disabled")
+		})
+
+		Convey("indirections should only apply to secret flags", func() {
+			env["START_PLAIN"] = "env:OTHER_VAR"
+			env["OTHER_VAR"] = "from other var"
+			So(Reparse(), ShouldBeNil)
+			So(*plain, ShouldEqual, "env:OTHER_VAR")
+		})
+
+		Convey("errors should not contain secret values", func() {
+			env["START_PIN"] = "not-a-number"
+			err := Reparse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "invalid value for secret flag --pin")
+			So(err.Error(), ShouldNotContainSubstring, "not-a-number")
+
+			env["START_PIN"] = "env:MISSING"
+			err = Reparse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "environment variable MISSING is not set")
+		})
+
+		Convey("help should redact secret values", func() {
+			env["START_TOKEN"] = "visible?"
+			env["START_PLAIN"] = "visible"
+			So(Reparse(), ShouldBeNil)
+			out := captureStderr(func() { flagUsage(os.Stderr, []string{"token", "plain", "pin"}) })
+			So(out, ShouldContainSubstring, "--token="+redacted)
+			So(out, ShouldContainSubstring, "--plain=visible")
+			So(out, ShouldContainSubstring, "--pin="+redacted)
+			So(out, ShouldNotContainSubstring, "visible?")
+			So(IsSecret("token"), ShouldBeTrue)
+			So(IsSecret("plain"), ShouldBeFalse)
+		})
+
+		Convey("Secret should fail for unknown flags", func() {
+			So(Secret("unknown"), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			secretCommandsAllowed = false
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+		})
+	})
+}
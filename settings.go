@@ -0,0 +1,151 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	// parseMu serializes parsing and reloading, which write to the flag
+	// variables, the config file, and the flag sources.
+	parseMu sync.Mutex
+
+	// settings holds the *Snapshot of the most recent successful parse.
+	settings atomic.Value
+)
+
+// Snapshot is an immutable view of all flag values and their sources at the
+// end of a successful Parse(), Reparse(), or config reload (see
+// WatchConfig()). Unlike the flag variables, a Snapshot is safe for
+// concurrent use: a reload publishes a new Snapshot but never modifies an
+// existing one.
+// Values are stored in the format of the flags' String() methods. The typed
+// getters convert them and return the zero value of their type if the flag
+// does not exist or has a different type.
+type Snapshot struct {
+	values  map[string]string
+	sources map[string]string
+	cfg     *configFile
+}
+
+// Settings returns the snapshot of the most recent successful parse.
+// Goroutines that read settings while the config file may get reloaded
+// should use Settings() instead of the flag variables. Get a new snapshot
+// for each unit of work, and use the same snapshot throughout that unit
+// to see consistent values.
+// Before Parse() or Up(), Settings returns an empty snapshot.
+func Settings() *Snapshot {
+	if s, ok := settings.Load().(*Snapshot); ok {
+		return s
+	}
+	return &Snapshot{}
+}
+
+// publishSettings stores a snapshot of the current flag values and sources.
+// The caller must hold parseMu.
+func publishSettings() {
+	s := &Snapshot{
+		values:  map[string]string{},
+		sources: map[string]string{},
+		cfg:     cfgFile,
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		s.values[f.Name] = f.Value.String()
+	})
+	for name, source := range flagSources {
+		s.sources[name] = source
+	}
+	settings.Store(s)
+}
+
+// Names returns the names of all flags, sorted.
+func (s *Snapshot) Names() []string {
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Value returns the value of the flag in the format of the flag's String()
+// method, and false if the flag does not exist.
+func (s *Snapshot) Value(name string) (string, bool) {
+	value, ok := s.values[name]
+	return value, ok
+}
+
+// String returns the value of a string flag.
+func (s *Snapshot) String(name string) string {
+	return s.values[name]
+}
+
+// Bool returns the value of a bool flag.
+func (s *Snapshot) Bool(name string) bool {
+	b, _ := strconv.ParseBool(s.values[name])
+	return b
+}
+
+// Int returns the value of an int flag.
+func (s *Snapshot) Int(name string) int {
+	i, _ := strconv.Atoi(s.values[name])
+	return i
+}
+
+// Float64 returns the value of a float flag.
+func (s *Snapshot) Float64(name string) float64 {
+	f, _ := strconv.ParseFloat(s.values[name], 64)
+	return f
+}
+
+// Duration returns the value of a duration flag.
+func (s *Snapshot) Duration(name string) time.Duration {
+	d, _ := time.ParseDuration(s.values[name])
+	return d
+}
+
+// StringSlice returns the value of a slice flag as strings.
+func (s *Snapshot) StringSlice(name string) []string {
+	value := s.values[name]
+	inner := strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if len(inner) == 0 {
+		return nil
+	}
+	vals, _ := splitList(inner)
+	return vals
+}
+
+// IsSet returns true if the command line, an environment variable, or the
+// config file has set the flag.
+func (s *Snapshot) IsSet(name string) bool {
+	_, ok := s.sources[name]
+	return ok
+}
+
+// Source describes where the value of the flag came from.
+// See FlagSource().
+func (s *Snapshot) Source(name string) string {
+	if source, ok := s.sources[name]; ok {
+		return source
+	}
+	return "default"
+}
+
+// ConfigFilePaths returns the paths of all config files that have been
+// read. See start.ConfigFilePaths().
+func (s *Snapshot) ConfigFilePaths() []string {
+	return s.cfg.Paths()
+}
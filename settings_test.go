@@ -0,0 +1,105 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestSettings(t *testing.T) {
+	Convey("Given flags from several sources", t, func() {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		configChangeFuncs = nil
+		flag.String("name", "default", "")
+		flag.Int("count", 1, "")
+		flag.Bool("verbose", false, "")
+		flag.Duration("timeout", time.Second, "")
+		flag.StringSlice("tags", nil, "")
+		files := fstest.MapFS{
+			"start.toml": {Data: []byte(`name = "config"
+tags = ["a", "b"]`)},
+		}
+		SetFileSystem(files)
+		SetEnvLookup(mapEnv(map[string]string{"START_COUNT": "2"}))
+		os.Args = []string{os.Args[0], "--verbose"}
+		So(Reparse(), ShouldBeNil)
+		s := Settings()
+
+		Convey("the snapshot should contain all values", func() {
+			So(s.String("name"), ShouldEqual, "config")
+			So(s.Int("count"), ShouldEqual, 2)
+			So(s.Bool("verbose"), ShouldBeTrue)
+			So(s.Duration("timeout"), ShouldEqual, time.Second)
+			So(s.StringSlice("tags"), ShouldResemble, []string{"a", "b"})
+			So(s.Names(), ShouldContain, "timeout")
+			_, ok := s.Value("nonexistent")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("the snapshot should contain all sources", func() {
+			So(s.Source("name"), ShouldStartWith, "config file")
+			So(s.Source("count"), ShouldEqual, "environment variable START_COUNT")
+			So(s.Source("verbose"), ShouldEqual, "command line")
+			So(s.Source("timeout"), ShouldEqual, "default")
+			So(s.IsSet("name"), ShouldBeTrue)
+			So(s.IsSet("timeout"), ShouldBeFalse)
+			So(s.ConfigFilePaths(), ShouldResemble, []string{"/start.toml"})
+		})
+
+		Convey("a reload should publish a new snapshot and leave the old one unchanged", func() {
+			files["start.toml"] = &fstest.MapFile{Data: []byte(`name = "new config"`)}
+			So(reloadConfig(), ShouldBeNil)
+			So(Settings().String("name"), ShouldEqual, "new config")
+			So(Settings().StringSlice("tags"), ShouldBeNil)
+			So(s.String("name"), ShouldEqual, "config")
+			So(s.StringSlice("tags"), ShouldResemble, []string{"a", "b"})
+		})
+
+		Convey("a failed reload should not publish a new snapshot", func() {
+			files["start.toml"] = &fstest.MapFile{Data: []byte(`timeout = "forever"`)}
+			So(reloadConfig(), ShouldNotBeNil)
+			So(Settings(), ShouldEqual, s)
+		})
+
+		Convey("reading snapshots during reloads should be safe", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						name := Settings().String("name")
+						if name != "config" && name != "new config" {
+							t.Errorf("unexpected value %q", name)
+						}
+					}
+				}()
+			}
+			for i := 0; i < 20; i++ {
+				if i%2 == 0 {
+					files["start.toml"] = &fstest.MapFile{Data: []byte(`name = "new config"`)}
+				} else {
+					files["start.toml"] = &fstest.MapFile{Data: []byte(`name = "config"`)}
+				}
+				So(reloadConfig(), ShouldBeNil)
+			}
+			wg.Wait()
+		})
+
+		Reset(func() {
+			ResetState()
+		})
+	})
+}
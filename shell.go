@@ -0,0 +1,300 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	flag "github.com/spf13/pflag"
+)
+
+// shellEnabled is true if EnableShell() has been called.
+var shellEnabled bool
+
+// newLineReader returns the reader for the shell's input: a line editor if
+// stdin is a terminal, or a plain line reader otherwise. Tests replace it.
+var newLineReader = func() lineReader {
+	if f, isFile := defaultStdin().(*os.File); isFile && isTerminal(f) {
+		if restore, err := makeRaw(f); err == nil {
+			restore()
+			return newLineEditor(f, defaultStderr())
+		}
+	}
+	return &plainReader{in: bufferedStdin()}
+}
+
+// EnableShell adds the command "shell", which reads commands from stdin
+// and executes them one after the other, until the user enters "exit" or
+// "quit", or presses Ctrl-D.
+// Each line works like the arguments of a new invocation of the
+// application: Flags and their values start from scratch (see Reparse())
+// except for the flags passed to the shell command itself, which apply to
+// all lines. The config file is read again for each line.
+// On a terminal, the shell provides line editing, a history that persists
+// in the user's state dir (see GetUserStateDir()), and completion of
+// commands, subcommands, and flags via the Tab key. Lines that set a secret
+// flag (see Secret()) are not saved in the history file.
+// Call EnableShell before Up().
+func EnableShell() {
+	shellEnabled = true
+}
+
+// shellCommand returns the built-in shell command. Up() runs the shell
+// itself rather than calling Cmd, which only runs if the user enters
+// "shell" in the shell.
+func shellCommand() *Command {
+	return &Command{
+		Name:  "shell",
+		Short: "Starts an interactive shell for entering commands.",
+		Long: "Starts an interactive shell that executes commands line by line.\n" +
+			"Enter exit or quit, or press Ctrl-D, to leave the shell.",
+		Cmd: func(cmd *Command) error {
+			return errors.New("The shell is running already.")
+		},
+	}
+}
+
+// runShell reads and executes commands until the end of the input.
+// Parse errors and failing commands do not end the shell.
+func runShell() error {
+	parseMu.Lock()
+	shellArgs := changedFlagArgs()
+	mainFlags := flag.CommandLine
+	flag.CommandLine = shellFlagSet(mainFlags)
+	parsedFlags = flag.CommandLine
+	parseMu.Unlock()
+	defer func() {
+		parseMu.Lock()
+		flag.CommandLine = mainFlags
+		parsedFlags = mainFlags
+		parseMu.Unlock()
+	}()
+
+	in := newLineReader()
+	for {
+		line, err := in.readLine(displayName() + "> ")
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		words, err := splitWords(line)
+		if err != nil {
+			errPrintln("Error:", err)
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		in.addHistory(line, !setsSecret(words))
+		if words[0] == "exit" || words[0] == "quit" {
+			return nil
+		}
+		err = runShellLine(append(shellArgs[:len(shellArgs):len(shellArgs)], words...), words)
+		if err != nil {
+			errPrintln("Error:", err)
+		}
+	}
+}
+
+// runShellLine parses args and executes the command that they contain.
+// words are the words of the line as the user has entered them.
+func runShellLine(args, words []string) error {
+	parseMu.Lock()
+	err := parseArgs(args, true)
+	parseMu.Unlock()
+	if err == flag.ErrHelp {
+		return Usage(nil)
+	}
+	if err != nil {
+		return err
+	}
+	cmdArgs := flag.Args()
+	if len(cmdArgs) == 0 {
+		return nil
+	}
+	if _, ok := Commands[cmdArgs[0]]; !ok {
+		return errors.New("Unknown command: " + cmdArgs[0] + ". Type help to list the commands.")
+	}
+	rawCmdArgs = strings.Join(words[1:], " ")
+	cmd, err := readCommand(cmdArgs)
+	if err != nil {
+		return err
+	}
+	return runCommand(cmd)
+}
+
+// shellFlagSet returns a flag set with the flags of fs that returns errors
+// instead of exiting the process or printing the usage.
+func shellFlagSet(fs *flag.FlagSet) *flag.FlagSet {
+	shellFlags := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	shellFlags.SortFlags = fs.SortFlags
+	shellFlags.ParseErrorsAllowlist = fs.ParseErrorsAllowlist
+	shellFlags.SetNormalizeFunc(fs.GetNormalizeFunc())
+	shellFlags.SetOutput(io.Discard)
+	shellFlags.Usage = func() {}
+	fs.VisitAll(shellFlags.AddFlag)
+	return shellFlags
+}
+
+// changedFlagArgs returns the flags that the command line has set, as
+// arguments that set the same values again.
+func changedFlagArgs() []string {
+	var args []string
+	flag.VisitAll(func(f *flag.Flag) {
+		if !f.Changed {
+			return
+		}
+		if sv, isSlice := f.Value.(flag.SliceValue); isSlice {
+			for _, val := range sv.GetSlice() {
+				args = append(args, "--"+f.Name+"="+val)
+			}
+			return
+		}
+		val := f.Value.String()
+		if isMapFlag(f) {
+			val = strings.TrimSuffix(strings.TrimPrefix(val, "["), "]")
+		}
+		args = append(args, "--"+f.Name+"="+val)
+	})
+	return args
+}
+
+// setsSecret returns true if words contain a secret flag.
+func setsSecret(words []string) bool {
+	for _, w := range words {
+		name := strings.SplitN(strings.TrimLeft(w, "-"), "=", 2)[0]
+		var f *flag.Flag
+		switch {
+		case strings.HasPrefix(w, "--"):
+			f = flag.Lookup(name)
+		case strings.HasPrefix(w, "-") && len(name) > 0:
+			f = flag.ShorthandLookup(name[:1])
+		}
+		if f != nil && isSecret(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitWords splits a line at white space. Single or double quotes enclose
+// words that contain white space, and a backslash escapes the next
+// character outside single quotes.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("missing closing quote " + string(quote))
+	}
+	if escaped {
+		return nil, errors.New("backslash at the end of the line")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// completions returns the commands, subcommands, or flags that complete
+// the last word of line, sorted.
+func completions(line string) []string {
+	words := strings.Fields(line)
+	partial := ""
+	if len(words) > 0 && !strings.HasSuffix(line, " ") {
+		partial = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	var args []string // the words that are not flags
+	for _, w := range words {
+		if !strings.HasPrefix(w, "-") {
+			args = append(args, w)
+		}
+	}
+	var candidates []string
+	switch {
+	case strings.HasPrefix(partial, "-"):
+		relevant := commandFlagNames(args)
+		flag.VisitAll(func(f *flag.Flag) {
+			if !f.Hidden && (!privateFlags[f.Name] || relevant[f.Name]) {
+				candidates = append(candidates, "--"+f.Name)
+			}
+		})
+	case len(args) == 0:
+		candidates = append(commandNames(nil), "exit", "quit")
+	case args[0] == "help" && len(args) <= 2:
+		candidates = commandNames(args[1:])
+	case len(args) == 1:
+		candidates = commandNames(args)
+	}
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, partial) {
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// commandNames returns the names of the top-level commands if path is
+// empty, or the names of the subcommands of the command named path[0].
+func commandNames(path []string) []string {
+	var names []string
+	if len(path) == 0 {
+		for name := range Commands {
+			if name != "shell" {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	if cmd, ok := Commands[path[0]]; ok {
+		for name := range cmd.children {
+			names = append(names, name)
+		}
+	}
+	return names
+}
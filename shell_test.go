@@ -0,0 +1,175 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestShell(t *testing.T) {
+	Convey("Given an application with the shell enabled", t, func() {
+		oldArgs := os.Args
+		oldNewLineReader := newLineReader
+		ResetState()
+		EnableShell()
+		loud := flag.Bool("loud", false, "Greet loudly")
+		name := flag.String("name", "World", "Whom to greet")
+		var greetings []string
+		Add(&Command{
+			Name:  "greet",
+			Flags: []string{"name"},
+			Cmd: func(cmd *Command) error {
+				greeting := "Hello " + *name
+				if *loud {
+					greeting = strings.ToUpper(greeting)
+				}
+				greetings = append(greetings, greeting)
+				return nil
+			},
+		})
+		input := func(lines ...string) {
+			newLineReader = func() lineReader {
+				return &plainReader{in: bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))}
+			}
+		}
+
+		Convey("the shell should run commands until exit", func() {
+			input("greet --name=Joe", "", "greet", "exit", "greet")
+			os.Args = []string{os.Args[0], "shell"}
+			out := captureStderr(Up)
+			So(ExitCode(), ShouldEqual, 0)
+			So(greetings, ShouldResemble, []string{"Hello Joe", "Hello World"})
+			So(out, ShouldEqual, "")
+		})
+
+		Convey("errors should not end the shell", func() {
+			input("bogus", "greet --unknown", "greet 'unterminated", "shell", "greet")
+			os.Args = []string{os.Args[0], "shell"}
+			out := captureStderr(Up)
+			So(ExitCode(), ShouldEqual, 0)
+			So(greetings, ShouldResemble, []string{"Hello World"})
+			So(out, ShouldContainSubstring, "Error: Unknown command: bogus. Type help to list the commands.")
+			So(out, ShouldContainSubstring, "Error: unknown flag: --unknown")
+			So(out, ShouldContainSubstring, "Error: missing closing quote '")
+			So(out, ShouldContainSubstring, "Error: The shell is running already.")
+		})
+
+		Convey("flags passed to the shell should apply to all lines", func() {
+			input("greet --name=Joe", "greet")
+			os.Args = []string{os.Args[0], "--loud", "shell"}
+			captureStderr(Up)
+			So(greetings, ShouldResemble, []string{"HELLO JOE", "HELLO WORLD"})
+		})
+
+		Convey("config flags should apply to the line that sets them", func() {
+			SetFileSystem(fstest.MapFS{"start.toml": {Data: []byte(`name = "base"
+[profile.prod]
+name = "prod"`)}})
+			input("--profile prod greet", "greet", "--no-config greet")
+			os.Args = []string{os.Args[0], "shell"}
+			captureStderr(Up)
+			So(greetings, ShouldResemble, []string{"Hello prod", "Hello base", "Hello World"})
+		})
+
+		Convey("config flags passed to the shell should apply to all lines", func() {
+			SetFileSystem(fstest.MapFS{"start.toml": {Data: []byte(`name = "base"
+[profile.prod]
+name = "prod"`)}})
+			input("greet", "greet")
+			os.Args = []string{os.Args[0], "--profile=prod", "shell"}
+			captureStderr(Up)
+			So(greetings, ShouldResemble, []string{"Hello prod", "Hello prod"})
+		})
+
+		Convey("the shell should restore the flag set", func() {
+			input("greet")
+			os.Args = []string{os.Args[0], "shell"}
+			commandLine := flag.CommandLine
+			captureStderr(Up)
+			So(flag.CommandLine, ShouldEqual, commandLine)
+		})
+
+		Reset(func() {
+			os.Args = oldArgs
+			newLineReader = oldNewLineReader
+			ResetState()
+		})
+	})
+}
+
+func TestSplitWords(t *testing.T) {
+	Convey("splitWords should split a line like a shell", t, func() {
+		words, err := splitWords(`  greet --name="Joe Doe" 'it''s' a\ b "\"q\""  `)
+		So(err, ShouldBeNil)
+		So(words, ShouldResemble, []string{"greet", "--name=Joe Doe", "its", "a b", `"q"`})
+		words, err = splitWords(`''`)
+		So(err, ShouldBeNil)
+		So(words, ShouldResemble, []string{""})
+		_, err = splitWords(`greet "Joe`)
+		So(err, ShouldNotBeNil)
+		_, err = splitWords(`greet \`)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCompletions(t *testing.T) {
+	Convey("Given commands with subcommands and flags", t, func() {
+		ResetState()
+		flag.Bool("verbose", false, "")
+		flag.String("url", "", "")
+		flag.Bool("force", false, "")
+		Add(&Command{Name: "remote", Flags: []string{"url"}})
+		Commands["remote"].Add(&Command{Name: "add", Cmd: func(cmd *Command) error { return nil }})
+		Commands["remote"].Add(&Command{Name: "remove", Cmd: func(cmd *Command) error { return nil }})
+		Add(&Command{Name: "push", Flags: []string{"force"}})
+		Commands["shell"] = shellCommand()
+
+		Convey("the first word should complete to commands", func() {
+			So(completions(""), ShouldResemble, []string{"exit", "push", "quit", "remote"})
+			So(completions("re"), ShouldResemble, []string{"remote"})
+		})
+
+		Convey("the second word should complete to subcommands", func() {
+			So(completions("remote "), ShouldResemble, []string{"add", "remove"})
+			So(completions("remote --verbose rem"), ShouldResemble, []string{"remove"})
+			So(completions("help remote a"), ShouldResemble, []string{"add"})
+			So(completions("push "), ShouldBeNil)
+		})
+
+		Convey("flags should complete to global flags and the command's flags", func() {
+			So(completions("remote --"), ShouldContain, "--url")
+			So(completions("remote --"), ShouldContain, "--verbose")
+			So(completions("remote --"), ShouldNotContain, "--force")
+			So(completions("--v"), ShouldResemble, []string{"--verbose"})
+		})
+
+		Reset(func() {
+			ResetState()
+		})
+	})
+}
+
+func TestSetsSecret(t *testing.T) {
+	Convey("setsSecret should detect secret flags", t, func() {
+		ResetState()
+		flag.StringP("token", "t", "", "")
+		flag.String("name", "", "")
+		So(Secret("token"), ShouldBeNil)
+		So(setsSecret([]string{"login", "--token=abc"}), ShouldBeTrue)
+		So(setsSecret([]string{"login", "-t", "abc"}), ShouldBeTrue)
+		So(setsSecret([]string{"login", "--name=abc"}), ShouldBeFalse)
+		ResetState()
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// defaultGracePeriod is the grace period unless set via SetGracePeriod().
+const defaultGracePeriod = 10 * time.Second
+
+var (
+	// gracePeriod is the time a command gets for shutting down after the
+	// first SIGINT or SIGTERM has cancelled its context.
+	gracePeriod = defaultGracePeriod
+
+	// exit terminates the process. Tests replace it with a harmless function.
+	exit = os.Exit
+)
+
+// SetGracePeriod sets the time that a command has for cleaning up after the
+// first SIGINT or SIGTERM has cancelled its context. When the grace period is
+// over, or when a second signal arrives, the application exits immediately.
+// A grace period of zero or less disables the timeout; the application then
+// waits for the command to return or for a second signal.
+func SetGracePeriod(d time.Duration) {
+	gracePeriod = d
+}
+
+// signalContext returns a context that gets cancelled when the process
+// receives SIGINT or SIGTERM. If graceful returns false at that time, the
+// process exits instead. The returned stop function cancels the context
+// and removes the signal handler; call it when the command has returned.
+func signalContext(graceful func() bool) (context.Context, func()) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go watchSignals(sigs, cancel, done, graceful)
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel()
+	}
+}
+
+// watchSignals cancels the command's context on the first signal, or exits
+// the process right away if graceful returns false, as the command ignores
+// its context. It then waits for the command to finish (done gets closed).
+// If instead a second signal arrives or the grace period ends, it exits the
+// process.
+func watchSignals(sigs <-chan os.Signal, cancel context.CancelFunc, done <-chan struct{}, graceful func() bool) {
+	var sig os.Signal
+	select {
+	case sig = <-sigs:
+		if !graceful() {
+			exit(signalExitCode(sig))
+			return
+		}
+		cancel()
+	case <-done:
+		return
+	}
+	var timeout <-chan time.Time
+	if gracePeriod > 0 {
+		timer := time.NewTimer(gracePeriod)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case sig = <-sigs:
+	case <-timeout:
+	case <-done:
+		return
+	}
+	exit(signalExitCode(sig))
+}
+
+// signalExitCode returns the conventional exit code for a process
+// terminated by sig, which is 128 plus the signal number.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
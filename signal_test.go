@@ -0,0 +1,139 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestWatchSignals(t *testing.T) {
+	oldExit, oldGracePeriod := exit, gracePeriod
+	defer func() {
+		exit, gracePeriod = oldExit, oldGracePeriod
+	}()
+
+	Convey("Given a signal watcher", t, func() {
+		exitCode := make(chan int, 1)
+		exit = func(code int) { exitCode <- code }
+		sigs := make(chan os.Signal, 2)
+		done := make(chan struct{})
+		ctx, cancel := context.WithCancel(context.Background())
+		SetGracePeriod(0)
+		finished := make(chan struct{})
+		go func() {
+			watchSignals(sigs, cancel, done, func() bool { return true })
+			close(finished)
+		}()
+
+		Convey("the first signal should cancel the context", func() {
+			sigs <- os.Interrupt
+			<-ctx.Done()
+			So(ctx.Err(), ShouldEqual, context.Canceled)
+
+			Convey("and a second signal should force an exit", func() {
+				sigs <- syscall.SIGTERM
+				<-finished
+				So(<-exitCode, ShouldEqual, 128+int(syscall.SIGTERM))
+			})
+
+			Convey("but no exit should happen if the command returns in time", func() {
+				close(done)
+				<-finished
+				So(len(exitCode), ShouldEqual, 0)
+			})
+		})
+
+		Reset(func() {
+			cancel()
+		})
+	})
+
+	Convey("Given a signal watcher with a grace period", t, func() {
+		exitCode := make(chan int, 1)
+		exit = func(code int) { exitCode <- code }
+		sigs := make(chan os.Signal, 2)
+		_, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		SetGracePeriod(10 * time.Millisecond)
+		go watchSignals(sigs, cancel, make(chan struct{}), func() bool { return true })
+
+		Convey("a command that does not return within the grace period should be terminated", func() {
+			sigs <- os.Interrupt
+			So(<-exitCode, ShouldEqual, 128+int(syscall.SIGINT))
+		})
+	})
+
+	Convey("Given a signal watcher for a command that ignores its context", t, func() {
+		exitCode := make(chan int, 1)
+		exit = func(code int) { exitCode <- code }
+		sigs := make(chan os.Signal, 2)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		SetGracePeriod(0)
+		go watchSignals(sigs, cancel, make(chan struct{}), func() bool { return false })
+
+		Convey("the first signal should terminate the application", func() {
+			sigs <- os.Interrupt
+			So(<-exitCode, ShouldEqual, 128+int(syscall.SIGINT))
+			So(ctx.Err(), ShouldBeNil)
+		})
+	})
+}
+
+func TestHandlesSignals(t *testing.T) {
+	Convey("A command should handle signals if it uses RunE or has called Context()", t, func() {
+		cmd := &Command{Cmd: func(cmd *Command) error { return nil }}
+		So(cmd.handlesSignals(), ShouldBeFalse)
+		cmd.Context()
+		So(cmd.handlesSignals(), ShouldBeTrue)
+		So((&Command{RunE: func(ctx context.Context, cmd *Command) error { return nil }}).handlesSignals(), ShouldBeTrue)
+	})
+}
+
+func TestUpRunE(t *testing.T) {
+	var gotCtx context.Context
+	var cmdCtx context.Context
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	var testflag, jsonflag string
+	flag.StringVarP(&testflag, "t", "t", "t", "t")
+	flag.StringVarP(&jsonflag, "j", "j", "j", "j")
+
+	os.Args = []string{os.Args[0], "ctxcmd"}
+
+	Commands = make(CommandMap)
+	Add(&Command{
+		Name: "ctxcmd",
+		RunE: func(ctx context.Context, cmd *Command) error {
+			gotCtx = ctx
+			cmdCtx = cmd.Context()
+			return nil
+		},
+	})
+
+	Up()
+
+	Convey("Up() should call RunE with a context", t, func() {
+		So(gotCtx, ShouldNotBeNil)
+		So(cmdCtx, ShouldEqual, gotCtx)
+		Convey("and cancel the context after the command has returned", func() {
+			So(gotCtx.Err(), ShouldEqual, context.Canceled)
+		})
+	})
+
+	Convey("A command that has not been run should return a background context", t, func() {
+		So((&Command{}).Context(), ShouldEqual, context.Background())
+	})
+}
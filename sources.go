@@ -0,0 +1,469 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laurent22/toml-go"
+	flag "github.com/spf13/pflag"
+)
+
+// flagSources maps the names of all flags that parse() has set to a
+// description of the source of the value. See FlagSource().
+var flagSources = map[string]string{}
+
+// flagDefaults maps each flag that parse() has seen to its original default
+// value, as parse() replaces the DefValue of flags that the config file or
+// the environment sets.
+var flagDefaults = map[*flag.Flag]string{}
+
+// FlagSource describes where the value of the flag with the given name came
+// from: "command line", "environment variable <NAME>",
+// "config file <path>:<line>", or "default" if no source has set the flag.
+// Use after calling Up() or Parse().
+func FlagSource(name string) string {
+	return Settings().Source(name)
+}
+
+// flagSource works like FlagSource but returns the source from the
+// current parse, which has not been published yet.
+func flagSource(name string) string {
+	if source, ok := flagSources[name]; ok {
+		return source
+	}
+	return "default"
+}
+
+// isSet returns true if any source has set the flag with the given name.
+func isSet(name string) bool {
+	_, ok := flagSources[name]
+	return ok
+}
+
+// applyConfig sets flag f from the config file, if the config file contains
+// a value for the flag.
+// TOML arrays populate slice flags, and tables (either a section or an
+// inline table) populate map flags. Integers populate duration flags as
+// seconds. All other values are passed to the flag's Set() method in their
+// TOML representation, without the quotes around strings.
+func applyConfig(c *configFile, f *flag.Flag) error {
+	key := configKey(f)
+	if isMapFlag(f) {
+		table, s, exists, err := c.table(key)
+		if !exists {
+			return nil
+		}
+		if err == nil {
+			err = setMap(f, joinTable(table))
+		}
+		if err != nil {
+			return errors.New(s.position() + ": " + key + ": " + invalidValueMsg(f, err))
+		}
+		flagSources[f.Name] = "config file " + s.position()
+		return nil
+	}
+	s, exists := c.setting(key)
+	if !exists {
+		return nil
+	}
+	var via string
+	var err error
+	if valueKind(s.value) == kindArray {
+		var vals []string
+		for _, elem := range s.value.AsArray() {
+			vals = append(vals, scalarString(elem))
+		}
+		err = setList(f, vals)
+	} else {
+		val := scalarString(s.value)
+		if isSecret(f) {
+			val, via, err = resolveSecret(val)
+			if err != nil {
+				return errors.New(s.position() + ": " + key + ": flag --" + f.Name + ": " + err.Error())
+			}
+		}
+		err = setScalar(f, val)
+	}
+	if err != nil {
+		return errors.New(s.position() + ": " + key + ": " + invalidValueMsg(f, err))
+	}
+	flagSources[f.Name] = sourceVia("config file "+s.position(), via)
+	return nil
+}
+
+// applyEnv sets flag f from its environment variable, if the variable is set
+// and not empty.
+// Slice flags take a comma-separated list, map flags a comma-separated list
+// of key=value pairs. Elements that contain commas must be enclosed in
+// double quotes, as in CSV files.
+func applyEnv(f *flag.Flag) error {
+	name := envVarName(f)
+	if len(name) == 0 {
+		return nil
+	}
+	val := getenv(name)
+	if len(val) == 0 {
+		return nil
+	}
+	var via string
+	var err error
+	if isSecret(f) {
+		val, via, err = resolveSecret(val)
+		if err != nil {
+			return errors.New("Environment variable " + name + ": flag --" + f.Name + ": " + err.Error())
+		}
+	}
+	if _, isSlice := f.Value.(flag.SliceValue); isSlice {
+		var vals []string
+		vals, err = splitList(val)
+		if err == nil {
+			err = setList(f, vals)
+		}
+	} else {
+		err = setScalar(f, val)
+	}
+	if err != nil {
+		return errors.New("Environment variable " + name + ": " + invalidValueMsg(f, err))
+	}
+	flagSources[f.Name] = sourceVia("environment variable "+name, via)
+	return nil
+}
+
+// resetFlags returns all flags except the config flags to their original
+// default values and clears their Changed fields, so that each parse starts
+// from the same state. Flags that resetFlags has not seen before keep their
+// values, and their DefValue becomes their original default value.
+// Flags whose default value cannot be set again, such as a nil IP address,
+// keep their current values until a source sets them.
+func resetFlags() {
+	flag.VisitAll(func(f *flag.Flag) {
+		if isConfigFlag(f) {
+			return
+		}
+		if sv, isSlice := f.Value.(sliceValue); isSlice {
+			rs, wrapped := sv.(*replacingSlice)
+			if !wrapped {
+				rs = &replacingSlice{sliceValue: sv}
+				f.Value = rs
+			}
+			rs.replace = true
+		}
+		if isMapFlag(f) {
+			rm, wrapped := f.Value.(*replacingMap)
+			if !wrapped {
+				rm = &replacingMap{Value: f.Value}
+				f.Value = rm
+			}
+			rm.replace = true
+		}
+		def, seen := flagDefaults[f]
+		if !seen {
+			flagDefaults[f] = f.DefValue
+			return
+		}
+		f.Changed = false
+		f.DefValue = def
+		if f.Value.String() != def {
+			resetValue(f, def)
+		}
+	})
+}
+
+// setDefValue makes the current value of flag f its default value if a
+// config file or an environment variable has set the flag, so that
+// f.Changed remains false unless the command line sets the flag.
+func setDefValue(f *flag.Flag) {
+	if isSet(f.Name) {
+		f.DefValue = f.Value.String()
+	}
+}
+
+// originalDefault returns the default value of flag f before any config
+// file or environment variable has replaced it.
+func originalDefault(f *flag.Flag) string {
+	if def, ok := flagDefaults[f]; ok {
+		return def
+	}
+	return f.DefValue
+}
+
+// sliceValue is the interface of pflag's slice flags.
+type sliceValue interface {
+	flag.Value
+	flag.SliceValue
+}
+
+// replacingSlice makes the first Set() of each parse replace the value of
+// a slice flag. pflag's slice flags append to their values once Set() has
+// been called, even if the previous call happened in an earlier parse.
+type replacingSlice struct {
+	sliceValue
+	replace bool
+}
+
+func (rs *replacingSlice) Set(val string) error {
+	if rs.replace {
+		rs.replace = false
+		if err := rs.Replace(nil); err != nil {
+			return err
+		}
+	}
+	return rs.sliceValue.Set(val)
+}
+
+// replacingMap makes the first Set() of each source replace the value of a
+// map flag, while further calls of Set() from the same source, such as
+// repeated command line flags, add to it. pflag's map flags merge all
+// values once Set() has been called, so a table from the config file would
+// otherwise leak into the values from the environment or the command line.
+type replacingMap struct {
+	flag.Value
+	replace bool
+}
+
+func (rm *replacingMap) Set(val string) error {
+	if rm.replace {
+		rm.replace = false
+		if err := clearMap(rm.Value); err != nil {
+			return err
+		}
+	}
+	return rm.Value.Set(val)
+}
+
+// setMap replaces the value of map flag f by the comma-separated key=value
+// pairs in val. The next source that sets the flag replaces the value again.
+func setMap(f *flag.Flag, val string) error {
+	rm, wrapped := f.Value.(*replacingMap)
+	if !wrapped {
+		if err := clearMap(f.Value); err != nil {
+			return err
+		}
+		return f.Value.Set(val)
+	}
+	rm.replace = true
+	err := rm.Set(val)
+	rm.replace = true
+	return err
+}
+
+// clearMap sets the map of a pflag map value to an empty map. pflag has no
+// API for this, so clearMap sets the map that the value's unexported field
+// "value" points to, which is the variable that the application passed to
+// pflag.
+func clearMap(v flag.Value) error {
+	if rm, wrapped := v.(*replacingMap); wrapped {
+		v = rm.Value
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Struct {
+		p := rv.Elem().FieldByName("value")
+		if p.IsValid() && p.Kind() == reflect.Ptr && !p.IsNil() && p.Type().Elem().Kind() == reflect.Map {
+			m := reflect.NewAt(p.Type().Elem(), p.UnsafePointer()).Elem()
+			m.Set(reflect.MakeMap(m.Type()))
+			return nil
+		}
+	}
+	return errors.New("cannot clear map value of type " + v.Type())
+}
+
+// setList replaces the value of a slice flag by vals.
+func setList(f *flag.Flag, vals []string) error {
+	sv, isSlice := f.Value.(flag.SliceValue)
+	if !isSlice {
+		return errors.New("a list requires a slice flag, not " + f.Value.Type())
+	}
+	return sv.Replace(vals)
+}
+
+// setScalar sets the flag from a single value. A slice flag receives a list
+// with a single element, replacing any previous value.
+func setScalar(f *flag.Flag, val string) error {
+	if isMapFlag(f) {
+		return setMap(f, val)
+	}
+	if sv, isSlice := f.Value.(flag.SliceValue); isSlice {
+		return sv.Replace([]string{val})
+	}
+	if f.Value.Type() == "duration" {
+		if secs, err := strconv.ParseInt(val, 10, 64); err == nil {
+			val = (time.Duration(secs) * time.Second).String()
+		}
+	}
+	return f.Value.Set(val)
+}
+
+// isMapFlag returns true for flags of pflag's map types.
+func isMapFlag(f *flag.Flag) bool {
+	return strings.HasPrefix(f.Value.Type(), "stringTo")
+}
+
+// invalidValueMsg returns the error message for a value that flag f
+// does not accept. For secret flags, the message omits the error from
+// the flag, which usually contains the value.
+func invalidValueMsg(f *flag.Flag, err error) string {
+	if isSecret(f) {
+		return "invalid value for secret flag --" + f.Name
+	}
+	return "invalid value for flag --" + f.Name + ": " + err.Error()
+}
+
+// sourceVia appends the origin of an indirect secret value to the source.
+func sourceVia(source, via string) string {
+	if len(via) == 0 {
+		return source
+	}
+	return source + " via " + via
+}
+
+// scalarString returns the string representation of a TOML value that
+// pflag's Set() methods understand.
+func scalarString(value toml.Value) string {
+	switch valueKind(value) {
+	case kindString:
+		return value.AsString()
+	case kindDate:
+		return value.AsDate().Format(time.RFC3339)
+	}
+	return value.String()
+}
+
+// splitList splits a comma-separated list, honoring double quotes.
+func splitList(s string) ([]string, error) {
+	r := csv.NewReader(strings.NewReader(s))
+	r.TrimLeadingSpace = true
+	return r.Read()
+}
+
+// joinTable returns the table as a comma-separated list of sorted
+// key=value pairs, as expected by the Set() method of map flags.
+func joinTable(table map[string]string) string {
+	keys := make([]string, 0, len(table))
+	for k := range table {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+table[k])
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(pairs)
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// table returns the contents of the table with the given name, either from
+// a section or from an inline table, from the profile or from the top level
+// of the config file or of the first layer that contains the table.
+// If the table exists but cannot be parsed, table returns an error.
+func (c *configFile) table(name string) (map[string]string, setting, bool, error) {
+	if len(c.profile) > 0 {
+		if table, s, exists, err := c.findTable(profileSection(c.profile) + "." + name); exists {
+			return table, s, true, err
+		}
+	}
+	return c.findTable(name)
+}
+
+// findTable returns the table at the dotted key from the config file itself
+// or, if the config file does not contain it, from the first layer that does.
+func (c *configFile) findTable(key string) (map[string]string, setting, bool, error) {
+	if raw, exists := c.rawValue(key); exists && strings.HasPrefix(raw, "{") {
+		table, err := parseInlineTable(raw)
+		return table, setting{file: c, key: key}, true, err
+	}
+	if c.hasSection(key) {
+		table := map[string]string{}
+		node, _ := c.doc.GetSection(key)
+		for name := range node.Children {
+			if value, isValue := c.get(key + "." + name); isValue {
+				table[name] = scalarString(value)
+			}
+		}
+		return table, setting{file: c, key: key}, true, nil
+	}
+	for _, layer := range c.layers {
+		if table, s, exists, err := layer.findTable(key); exists {
+			return table, s, true, err
+		}
+	}
+	return nil, setting{}, false, nil
+}
+
+// rawValue returns the unparsed value of the dotted key from the config
+// file itself. toml-go cannot parse inline tables, so these must be read
+// from the raw content.
+func (c *configFile) rawValue(key string) (string, bool) {
+	line := c.line(key)
+	if line == 0 {
+		return "", false
+	}
+	l := c.lines[line-1]
+	return strings.TrimSpace(l[strings.Index(l, "=")+1:]), true
+}
+
+// parseInlineTable parses a one-line inline table like {a = "x", b = 2}.
+// Values are returned in the format of scalarString. Nested tables and
+// arrays are not supported.
+func parseInlineTable(raw string) (map[string]string, error) {
+	end := strings.LastIndex(raw, "}")
+	if !strings.HasPrefix(raw, "{") || end < 0 {
+		return nil, errors.New("not an inline table: " + raw)
+	}
+	table := map[string]string{}
+	var parser toml.Parser
+	for _, pair := range splitOutsideQuotes(raw[1:end], ',') {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+		parts := splitOutsideQuotes(pair, '=')
+		if len(parts) != 2 {
+			return nil, errors.New("invalid inline table entry: " + pair)
+		}
+		key := strings.Trim(strings.TrimSpace(parts[0]), "\"")
+		// Let toml-go parse the value.
+		value, exists := parser.Parse("v = " + parts[1]).GetValue("v")
+		if !exists || valueKind(value) == kindNone || valueKind(value) == kindArray {
+			return nil, errors.New("invalid inline table entry: " + pair)
+		}
+		table[key] = scalarString(value)
+	}
+	return table, nil
+}
+
+// splitOutsideQuotes splits s at each sep that is not enclosed in
+// double quotes.
+func splitOutsideQuotes(s string, sep rune) []string {
+	var parts []string
+	inQuotes, escaped := false, false
+	start := 0
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && inQuotes:
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
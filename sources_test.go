@@ -0,0 +1,149 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestTypedSources(t *testing.T) {
+	Convey("Given flags of various pflag types", t, func() {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		os.Args = []string{os.Args[0]}
+		colors := flag.StringSlice("colors", []string{"black"}, "")
+		sizes := flag.IntSlice("sizes", nil, "")
+		labels := flag.StringToString("labels", nil, "")
+		limits := flag.StringToInt("limits", nil, "")
+		timeout := flag.Duration("timeout", time.Second, "")
+		wait := flag.Duration("wait", time.Second, "")
+		verbosity := flag.CountP("verbosity", "v", "")
+		ip := flag.IP("ip", nil, "")
+		ratio := flag.Float64("ratio", 0, "")
+		debug := flag.Bool("debug", false, "")
+		published := flag.String("published", "", "")
+		quote := flag.String("quote", "", "")
+
+		SetFileSystem(fstest.MapFS{
+			"start.toml": {Data: []byte(`colors = ["red", "blue, green"]
+sizes = [1, 2, 3]
+labels = {team = "core", "tier" = 2}
+timeout = 30
+wait = "1m"
+verbosity = 2
+ip = "10.0.0.1"
+ratio = 0.5
+debug = true
+published = 2014-08-17T09:25:00Z
+quote = "say \"hi\""
+
+[limits]
+cpu = 2
+mem = 512
+`)},
+		})
+		env := map[string]string{}
+		SetEnvLookup(mapEnv(env))
+
+		Convey("config values should map onto the flag types", func() {
+			So(Reparse(), ShouldBeNil)
+			So(*colors, ShouldResemble, []string{"red", "blue, green"})
+			So(*sizes, ShouldResemble, []int{1, 2, 3})
+			So(*labels, ShouldResemble, map[string]string{"team": "core", "tier": "2"})
+			So(*limits, ShouldResemble, map[string]int{"cpu": 2, "mem": 512})
+			So(*timeout, ShouldEqual, 30*time.Second)
+			So(*wait, ShouldEqual, time.Minute)
+			So(*verbosity, ShouldEqual, 2)
+			So(ip.Equal(net.ParseIP("10.0.0.1")), ShouldBeTrue)
+			So(*ratio, ShouldEqual, 0.5)
+			So(*debug, ShouldBeTrue)
+			So(*published, ShouldEqual, "2014-08-17T09:25:00Z")
+			So(*quote, ShouldEqual, `say "hi"`)
+
+			Convey("and parsing again should not append to slices", func() {
+				So(Reparse(), ShouldBeNil)
+				So(*colors, ShouldResemble, []string{"red", "blue, green"})
+			})
+		})
+
+		Convey("environment variables should replace config values, using list syntax", func() {
+			env["START_COLORS"] = `yellow, "cyan, magenta"`
+			env["START_LABELS"] = "team=ops,zone=eu"
+			So(Reparse(), ShouldBeNil)
+			So(*colors, ShouldResemble, []string{"yellow", "cyan, magenta"})
+			So((*labels)["zone"], ShouldEqual, "eu")
+
+			Convey("and command line flags should replace slices set from other sources", func() {
+				os.Args = []string{os.Args[0], "--colors", "white", "-vvv"}
+				So(Reparse(), ShouldBeNil)
+				So(*colors, ShouldResemble, []string{"white"})
+				So(*verbosity, ShouldEqual, 5)
+			})
+		})
+
+		Convey("environment variables should replace config tables of map flags", func() {
+			env["START_LABELS"] = "zone=eu"
+			env["START_LIMITS"] = "disk=10"
+			So(Reparse(), ShouldBeNil)
+			So(*labels, ShouldResemble, map[string]string{"zone": "eu"})
+			So(*limits, ShouldResemble, map[string]int{"disk": 10})
+		})
+
+		Convey("command line flags should replace config tables of map flags", func() {
+			os.Args = []string{os.Args[0], "--labels=zone=eu", "--labels=rack=3"}
+			So(Reparse(), ShouldBeNil)
+			So(*labels, ShouldResemble, map[string]string{"zone": "eu", "rack": "3"})
+			So(FlagSource("labels"), ShouldEqual, "command line")
+
+			Convey("and parsing without them should restore the config table", func() {
+				os.Args = []string{os.Args[0]}
+				So(Reparse(), ShouldBeNil)
+				So(*labels, ShouldResemble, map[string]string{"team": "core", "tier": "2"})
+			})
+		})
+
+		Convey("an invalid config value should be reported with file and line", func() {
+			SetFileSystem(fstest.MapFS{
+				"start.toml": {Data: []byte("debug = true\nsizes = [\"one\"]")},
+			})
+			err := Reparse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, filepath.FromSlash("/start.toml")+":2: sizes: invalid value for flag --sizes")
+		})
+
+		Convey("an invalid environment variable should be reported", func() {
+			env["START_RATIO"] = "half"
+			err := Reparse()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "START_RATIO")
+		})
+
+		Reset(func() {
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+		})
+	})
+}
+
+func TestParseInlineTable(t *testing.T) {
+	Convey("parseInlineTable should parse one-line inline tables", t, func() {
+		table, err := parseInlineTable(`{ a = "x, y", b = 2, "c=d" = true } # comment`)
+		So(err, ShouldBeNil)
+		So(table, ShouldResemble, map[string]string{"a": "x, y", "b": "2", "c=d": "true"})
+
+		_, err = parseInlineTable(`{ a }`)
+		So(err, ShouldNotBeNil)
+	})
+}
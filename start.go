@@ -18,8 +18,10 @@
 package start
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
 
@@ -41,10 +43,16 @@ var (
 	// package variables and private.
 	// These variables might get refactored into a struct at a later time.
 	App           string // app name
+	customAppName bool   // App was set via SetAppName()
+	multiCall     bool   // the invocation name can select a command
 	cfgFile       *configFile
 	cfgFileName   string
 	customName    bool
+	searchParents bool     // search the config file in parent dirs of the working dir
+	rootMarkers   []string // files or dirs that stop the search in parent dirs
 	alreadyParsed bool
+	parsedFlags   *flag.FlagSet // the flag set that Parse() has parsed
+	parsedArgs    []string      // the arguments of the latest parse, for config reloads
 	privateFlags  = privateFlagsMap{}
 	description   string
 	version       string
@@ -54,16 +62,85 @@ var (
 	// GlobalInit is called AFTER parsing and BEFORE invoking a command.
 	// If needed, assign your own function via SetInitFunc() before calling Up().
 	globalInit func() error
+
+	// globalCleanup is the counterpart of globalInit. Up() calls it after
+	// the command has finished, even if the initialization or the command
+	// failed. Assign your own function via SetCleanupFunc().
+	globalCleanup func() error
+
+	// exitCode is the exit status of the most recent Up() call.
+	exitCode int
+)
+
+// Exit codes that Up() reports via ExitCode().
+const (
+	exitOK    = 0
+	exitError = 1 // parsing, initialization, or the command failed
+	exitUsage = 2 // the command line contains an unknown command or flag
 )
 
 // SetConfigFile allows to set a custom file name and/or path.
 // Call this before Parse() or Up(), respectively. Afterwards it has of course
 // no effect.
+// At runtime, users can override the config file via the global flag
+// --config <path>, or disable reading any config file via --no-config.
 func SetConfigFile(fn string) {
 	cfgFileName = fn
 	customName = true
 }
 
+// SearchParentDirs enables project config discovery. Instead of looking for
+// the config file in the working directory only, start then searches the
+// working directory and its parent directories, the way linters and
+// formatters discover their project config. In each directory, start looks
+// for <appname>.toml and .<appname>.toml, or for the name set via
+// SetConfigFile().
+// The search stops at the root of the file system or after the first
+// directory that contains one of the given root markers. If no markers are
+// given, the marker is ".git", which stops the search at the root of a Git
+// repository.
+// A project config file takes precedence over the config file in the user's
+// config dir, which then only provides the values that the project config
+// file does not contain.
+// Call this before Parse() or Up(), respectively.
+func SearchParentDirs(markers ...string) {
+	if len(markers) == 0 {
+		markers = []string{".git"}
+	}
+	searchParents = true
+	rootMarkers = markers
+}
+
+// SetAppName sets the name of the application. By default, the name is the
+// name of the executable, with special characters replaced by underscores.
+// The name determines
+//
+//   - the names of the config file (<name>.toml) and of the config dirs,
+//   - the prefix of environment variables (see SetEnvPrefix()),
+//   - the names of external commands (<name>-<command>, see External()),
+//   - and the application name in the help output.
+//
+// A fixed name keeps all these stable if the executable gets renamed, or if
+// it is invoked through a symbolic link (see MultiCall()).
+// Call SetAppName before any other function of this package.
+func SetAppName(name string) {
+	App = name
+	customAppName = true
+}
+
+// MultiCall enables busybox-style invocation: If the name that the
+// application was invoked with (without path and extension) is the name of
+// a top-level command, Up() executes this command, as if the name were the
+// first argument. For example, with a symbolic link named "greet" that
+// points to the executable, "greet --loud Joe" is the same as
+// "app greet --loud Joe".
+// Use SetAppName() along with MultiCall(), so that the app name does not
+// depend on the name of the link.
+// Call MultiCall before Up().
+func MultiCall() {
+	multiCall = true
+}
+
 // SetDescription sets a description of the app. It receives a string containing
 // a brief description of the application. If a user runs the application with
 // no arguments, or if the user invokes the help command, Usage() will print
@@ -85,6 +162,16 @@ func SetInitFunc(initf func() error) {
 	globalInit = initf
 }
 
+// SetCleanupFunc sets a function that is called after the command has
+// finished. The function is called even if the global init function or the
+// command returned an error, so it can reliably release resources that the
+// init function has acquired (database connections, log files, etc).
+// Note that the init function may have failed halfway, so the cleanup
+// function should only release what actually has been acquired.
+func SetCleanupFunc(cleanupf func() error) {
+	globalCleanup = cleanupf
+}
+
 // Parse initializes all flag variables from command line flags, environment
 // variables, configuration file entries, or default values.
 // After this, each flag variable has a value either -
@@ -92,15 +179,19 @@ func SetInitFunc(initf func() error) {
 // - from an environment variable, if the flag is not set, or
 // - from an entry in the config file, if the environment variable is not set, or
 // - from its default value, if there is no entry in the config file.
-// Note: For better efficiency, Parse reads the config file and environment
-// variables only once. Subsequent calls only parse the flags again, so you can
-// call Parse() from multiple places in your code without actually repeating the
-// complete parse process. Use Reparse() if you must execute the full parse
-// process again.
+// Values from the config file and from environment variables become the
+// flags' default values (pflag.Flag.DefValue), so pflag.Flag.Changed is true
+// only for flags set on the command line. Use FlagSource() to find out which
+// source has set a flag.
+// Note: Parse parses only once. Subsequent calls do nothing unless
+// flag.CommandLine has been replaced, so you can call Parse() from multiple
+// places in your code without actually repeating the parse process. Use
+// Reparse() if you must execute the parse process again.
 // This behavior diverges from the behavior of flag.Parse(), which parses always.
 func Parse() error {
-	if alreadyParsed {
-		flag.Parse()
+	parseMu.Lock()
+	defer parseMu.Unlock()
+	if alreadyParsed && parsedFlags == flag.CommandLine {
 		return nil
 	}
 	err := parse()
@@ -108,50 +199,138 @@ func Parse() error {
 		return errors.New("Cannot parse flags: " + err.Error())
 	}
 	alreadyParsed = true
+	parsedFlags = flag.CommandLine
 	return nil
 }
 
 // Reparse is the same as Parse but parses always.
+// Each call starts from scratch: Reparse returns all flags to the default
+// values they were defined with, then reads the config file, the
+// environment variables, and the command line (os.Args) again. A flag
+// that was set in an earlier parse but has no source now returns to its
+// default value. Reparse cannot remove entries from map flags, though, as
+// pflag provides no way to clear them.
+// Reparse publishes a new snapshot of the settings (see Settings()) only
+// if it succeeds.
 func Reparse() error {
+	parseMu.Lock()
+	defer parseMu.Unlock()
 	return parse()
 }
 
+// parse reads all sources into the flags and publishes a snapshot of the
+// settings. The caller must hold parseMu.
 func parse() error {
+	return parseArgs(commandLineArgs(), false)
+}
+
+// parseArgs works like parse but reads the command line flags from args.
+// If strict is true, parseArgs returns errors from parsing args. Otherwise,
+// it leaves them to the error handling of flag.CommandLine, like
+// flag.Parse().
+func parseArgs(args []string, strict bool) error {
+	registerConfigFlags()
+	registerOutputFlag()
+	registerLogFlags()
+	resetFlags()
 	var err error
-	cfgFile, err = newConfigFile(cfgFileName)
+	parsedArgs = args
+	cfgFile, err = readConfigFile(args)
 	if err != nil {
 		return err
 	}
+	flagSources = map[string]string{}
 	flag.VisitAll(func(f *flag.Flag) {
+		if isConfigFlag(f) || err != nil {
+			return
+		}
 		// first, set the values from the config file:
-		val := cfgFile.String(f.Name)
-		if len(val) > 0 {
-			f.Value.Set(val)
+		err = applyConfig(cfgFile, f)
+		if err != nil {
+			return
 		}
 		// then, find and apply environment variables:
-		envVar := os.Getenv(strings.ToUpper(appName() + "_" + f.Name))
-		if len(envVar) > 0 {
-			f.Value.Set(envVar)
-		}
+		err = applyEnv(f)
+		setDefValue(f)
 	})
+	if err != nil {
+		return err
+	}
 	// finally, parse the command line flags:
-	flag.Parse()
+	err = flag.CommandLine.Parse(args)
+	if err != nil && strict {
+		return err
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Changed {
+			flagSources[f.Name] = "command line"
+		}
+	})
+	// last, ask the user for missing values:
+	err = promptMissing()
+	if err != nil {
+		return err
+	}
+	err = checkConstraints()
+	if err != nil {
+		return err
+	}
+	updateLogLevel()
+	publishSettings()
+	logConfigFiles("Read")
 	return nil
 }
 
+// commandLineArgs returns the command line arguments without the program name.
+func commandLineArgs() []string {
+	if len(os.Args) < 2 {
+		return nil
+	}
+	return os.Args[1:]
+}
+
+// commandArgs returns the arguments after the flags, starting with the
+// command name. If the invocation name selects a command (see MultiCall()),
+// commandArgs prepends the invocation name.
+func commandArgs() []string {
+	args := flag.Args()
+	if !multiCall {
+		return args
+	}
+	name := invocationName()
+	if _, isCmd := Commands[name]; !isCmd || name == appName() {
+		return args
+	}
+	rawCmdArgs = strings.Join(commandLineArgs(), " ")
+	return append([]string{name}, args...)
+}
+
 // Up parses all flags and then evaluates and executes the command line.
+// Afterwards, ExitCode() returns the exit status that the application should
+// return to the operating system.
 func Up() {
+	exitCode = exitOK
 	err := Parse()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error while parsing flags:")
-		fmt.Fprintln(os.Stderr, err)
+		errPrintln("Error while parsing flags:")
+		errPrintln(err)
+		exitCode = exitError
 		return
 	}
 
+	defer func() {
+		if err := globalCleanup(); err != nil {
+			errPrintln("Error during cleanup:")
+			errPrintln(err)
+			exitCode = exitError
+		}
+	}()
+
 	err = globalInit()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error during initialization:")
-		fmt.Fprintln(os.Stderr, err)
+		errPrintln("Error during initialization:")
+		errPrintln(err)
+		exitCode = exitError
 		return
 	}
 
@@ -172,43 +351,148 @@ func Up() {
 			Cmd:   showVersion,
 		}
 
-	cmd, err := readCommand(flag.Args())
+	if shellEnabled {
+		Commands["shell"] = shellCommand()
+	}
+
+	cmd, err := readCommand(commandArgs())
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error while reading a command:")
-		fmt.Fprintln(os.Stderr, err)
+		errPrintln("Error while reading a command:")
+		errPrintln(err)
+		exitCode = exitUsage
 		// Execution can continue safely despite the error, because in this
 		// case, readCommand returns the Usage command.
 	}
 
-	err = cmd.Cmd(cmd)
+	if watchConfig {
+		stopWatching := startWatching(context.Background())
+		defer stopWatching()
+	}
+	if shellEnabled && cmd == Commands["shell"] {
+		err = runShell()
+	} else {
+		err = runCommand(cmd)
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error on executing a command:")
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(cmd.stderr(), "Error on executing a command:")
+		fmt.Fprintln(cmd.stderr(), err)
+		exitCode = exitError
 	}
 }
 
+// runCommand executes cmd with a context that gets cancelled when the
+// process receives SIGINT or SIGTERM.
+func runCommand(cmd *Command) error {
+	ctx, stop := signalContext(cmd.handlesSignals)
+	defer stop()
+	defer cmd.initStreams()()
+	return cmd.execute(ctx)
+}
+
+// ExitCode returns the exit status of the most recent Up() call:
+// 0 if the command succeeded, 1 if parsing, initialization, or the command
+// failed, and 2 if the command line contained an unknown command or flag.
+// Typical usage:
+//
+//	start.Up()
+//	os.Exit(start.ExitCode())
+func ExitCode() int {
+	return exitCode
+}
+
+// ResetState restores the initial state of the package: It removes all commands
+// and flags, forgets the config file, and unsets all values and functions
+// set through the Set* functions and Use().
+// ResetState is meant for tests that run an application more than once in the
+// same process (see package starttest). The new flag set continues on
+// errors rather than exiting the process.
+func ResetState() {
+	Commands = CommandMap{}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	resetVars()
+}
+
+// resetVars sets all package variables to their initial values.
+func resetVars() {
+	App = defaultAppName()
+	customAppName = false
+	multiCall = false
+	cfgFile = nil
+	cfgFileName = ""
+	customName = false
+	searchParents = false
+	secretCommandsAllowed = false
+	rootMarkers = nil
+	alreadyParsed = false
+	parsedFlags = nil
+	parsedArgs = nil
+	stdinStream, stdoutStream, stderrStream = nil, nil, nil
+	stdinReader, stdinReaderSource = nil, nil
+	privateFlags = privateFlagsMap{}
+	description = ""
+	version = "1.0" // SetVersion() overrides this default.
+	rawCmdArgs = ""
+	if len(os.Args) >= 2 { // TODO why 2
+		rawCmdArgs = strings.Join(os.Args[2:], " ")
+	}
+	globalInit = func() error {
+		return nil
+	}
+	globalCleanup = func() error {
+		return nil
+	}
+	exitCode = exitOK
+	middlewares = nil
+	fileSystem = nil
+	lookupEnv = os.LookupEnv
+	workingDir = ""
+	configFlags = map[string]*flag.Flag{}
+	configFlagValue = ""
+	noConfigFlagValue = false
+	profileFlagValue = ""
+	gracePeriod = defaultGracePeriod
+	flagSources = map[string]string{}
+	flagDefaults = map[*flag.Flag]string{}
+	constraints = nil
+	envPrefix = ""
+	customEnvPrefix = false
+	watchConfig = false
+	configChangeFuncs = nil
+	pollInterval = defaultPollInterval
+	shellEnabled = false
+	outputEnabled = false
+	logFlagsEnabled = false
+	logLevel.Set(slog.LevelInfo)
+	groupOrder = nil
+	keepCommandOrder = false
+	commandCount = 0
+	settings.Store(&Snapshot{})
+}
+
 // ConfigFilePath returns the path of the config file that has been read in.
 // Use after calling Up() or Parse().
 // Returns an empty path if no config file was found.
 func ConfigFilePath() string {
-	return cfgFile.Path()
+	return Settings().cfg.Path()
+}
+
+// ConfigFilePaths returns the paths of all config files that have been read
+// in, in order of precedence: the config file that ConfigFilePath() returns,
+// followed by the config files from the system config dirs (see
+// GetSystemConfigDirs()), which provide the values that the first file does
+// not contain.
+// Use after calling Up() or Parse().
+func ConfigFilePaths() []string {
+	return Settings().cfg.Paths()
 }
 
 // ConfigFileToml returns the toml document created from the config file.
 // Useful for fetching additional content from the config file than the one used
 // by the flags.
 func ConfigFileToml() toml.Document {
-	return cfgFile.Toml()
+	return Settings().cfg.Toml()
 }
 
 func init() {
-	App = appName()
-	version = "1.0" // SetVersion() overrides this default.
-	rawCmdArgs = ""
-	if len(os.Args) >= 2 { // TODO why 2
-		rawCmdArgs = strings.Join(os.Args[2:], " ")
-	}
-	globalInit = func() error {
-		return nil
-	}
+	resetVars()
 }
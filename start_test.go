@@ -8,9 +8,11 @@
 package start
 
 import (
+	"errors"
 	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	. "github.com/smartystreets/goconvey/convey"
 	flag "github.com/spf13/pflag"
@@ -112,3 +114,166 @@ func TestUp(t *testing.T) {
 		So(cmd.Cmd, ShouldHaveSameTypeAs, help) // ShouldEqual errors out because of "different types" (since smarty/assertions@v1.15.0)
 	})
 }
+
+func TestCleanup(t *testing.T) {
+	var cleanedUp bool
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	var testflag, jsonflag string
+	flag.StringVarP(&testflag, "t", "t", "t", "t")
+	flag.StringVarP(&jsonflag, "j", "j", "j", "j")
+
+	os.Args = []string{os.Args[0], "failing"}
+
+	Commands = make(CommandMap)
+	Add(&Command{
+		Name: "failing",
+		Cmd: func(cmd *Command) error {
+			return errors.New("command failed")
+		},
+	})
+	SetCleanupFunc(func() error {
+		cleanedUp = true
+		return nil
+	})
+	defer SetCleanupFunc(func() error { return nil })
+
+	captureStderr(Up)
+
+	Convey("Up() should call the cleanup function even if the command fails", t, func() {
+		So(cleanedUp, ShouldBeTrue)
+	})
+}
+
+func TestSetAppName(t *testing.T) {
+	Convey("Given a custom app name", t, func() {
+		oldArgs := os.Args
+		ResetState()
+		SetAppName("my-tool")
+		var name string
+		flag.StringVar(&name, "name", "default", "A name")
+		SetFileSystem(fstest.MapFS{
+			"my-tool.toml":       {Data: []byte(`name = "working dir"`)},
+			"elsewhere/cfg.toml": {Data: []byte(`name = "elsewhere"`)},
+		})
+		env := map[string]string{}
+		SetEnvLookup(mapEnv(env))
+		os.Args = []string{os.Args[0]}
+
+		Convey("config discovery should look for <name>.toml", func() {
+			So(Parse(), ShouldBeNil)
+			So(name, ShouldEqual, "working dir")
+		})
+
+		Convey("environment variables should use the name as prefix", func() {
+			env["MY_TOOL_NAME"] = "env"
+			So(Parse(), ShouldBeNil)
+			So(name, ShouldEqual, "env")
+			So(EnvName("profile"), ShouldEqual, "MY_TOOL_PROFILE")
+		})
+
+		Convey("<NAME>_CFGPATH should select the config file", func() {
+			env["MY_TOOL_CFGPATH"] = "/elsewhere/cfg.toml"
+			So(Parse(), ShouldBeNil)
+			So(name, ShouldEqual, "elsewhere")
+		})
+
+		Convey("the help output should show the name", func() {
+			So(Parse(), ShouldBeNil)
+			out := captureStderr(func() { Usage(nil) })
+			So(out, ShouldStartWith, "\nmy-tool\n")
+			So(out, ShouldContainSubstring, "Type my-tool help <command>")
+		})
+
+		Convey("with MultiCall(), the invocation name should select the command", func() {
+			var got []string
+			Add(&Command{Name: "greet", Cmd: func(cmd *Command) error {
+				got = cmd.Args
+				return nil
+			}})
+			MultiCall()
+			os.Args = []string{"/usr/local/bin/greet", "Joe"}
+			Up()
+			So(ExitCode(), ShouldEqual, 0)
+			So(got, ShouldResemble, []string{"Joe"})
+		})
+
+		Convey("without MultiCall(), the invocation name should not matter", func() {
+			called := false
+			Add(&Command{Name: "greet", Cmd: func(cmd *Command) error {
+				called = true
+				return nil
+			}})
+			os.Args = []string{"/usr/local/bin/greet", "Joe"}
+			captureStderr(Up)
+			So(called, ShouldBeFalse)
+		})
+
+		Reset(func() {
+			os.Args = oldArgs
+			ResetState()
+		})
+	})
+}
+
+func TestReparse(t *testing.T) {
+	Convey("Given flags from all sources", t, func() {
+		oldArgs := os.Args
+		ResetState()
+		name := flag.String("name", "default", "")
+		count := flag.Int("count", 1, "")
+		verbose := flag.CountP("verbose", "v", "")
+		tags := flag.StringSlice("tags", []string{"default"}, "")
+		files := fstest.MapFS{
+			"start.toml": {Data: []byte(`name = "config"`)},
+		}
+		SetFileSystem(files)
+		SetEnvLookup(mapEnv(map[string]string{"START_COUNT": "2"}))
+		os.Args = []string{os.Args[0], "-vv", "--tags=a", "--tags=b"}
+		So(Parse(), ShouldBeNil)
+
+		Convey("only command line flags should be changed", func() {
+			So(flag.Lookup("verbose").Changed, ShouldBeTrue)
+			So(flag.Lookup("tags").Changed, ShouldBeTrue)
+			So(flag.Lookup("name").Changed, ShouldBeFalse)
+			So(flag.Lookup("count").Changed, ShouldBeFalse)
+		})
+
+		Convey("config and environment values should become the default values", func() {
+			So(flag.Lookup("name").DefValue, ShouldEqual, "config")
+			So(flag.Lookup("count").DefValue, ShouldEqual, "2")
+			So(flag.Lookup("verbose").DefValue, ShouldEqual, "0")
+		})
+
+		Convey("Parse should not parse again", func() {
+			os.Args = []string{os.Args[0], "--name=cmdline"}
+			So(Parse(), ShouldBeNil)
+			So(*name, ShouldEqual, "config")
+		})
+
+		Convey("Reparse should yield the same values for the same sources", func() {
+			So(Reparse(), ShouldBeNil)
+			So(*verbose, ShouldEqual, 2)
+			So(*tags, ShouldResemble, []string{"a", "b"})
+			So(*name, ShouldEqual, "config")
+			So(*count, ShouldEqual, 2)
+		})
+
+		Convey("Reparse should start from the original default values", func() {
+			os.Args = []string{os.Args[0]}
+			delete(files, "start.toml")
+			So(Reparse(), ShouldBeNil)
+			So(*verbose, ShouldEqual, 0)
+			So(*tags, ShouldResemble, []string{"default"})
+			So(*name, ShouldEqual, "default")
+			So(flag.Lookup("name").DefValue, ShouldEqual, "default")
+			So(flag.Lookup("verbose").Changed, ShouldBeFalse)
+			So(FlagSource("tags"), ShouldEqual, "default")
+		})
+
+		Reset(func() {
+			os.Args = oldArgs
+			ResetState()
+		})
+	})
+}
@@ -0,0 +1,142 @@
+// Package starttest runs a command line application built with package start
+// in-process, for testing purposes.
+//
+// Run executes the complete start.Up() pipeline (parsing config file,
+// environment variables, and flags, then dispatching the command) in an
+// isolated environment and captures everything the application writes to
+// stdout and stderr, together with the exit code. Golden() compares the
+// captured output against a golden file.
+//
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+package starttest
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/christophberger/start"
+)
+
+// Result contains the output and the exit code of a Run.
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// mu serializes Run calls, as package start and the environment of the
+// process are global state.
+var mu sync.Mutex
+
+// Run runs an application with the given command line arguments, environment
+// variables, and files.
+//
+// Parameter app sets up the application the same way as the application's
+// main() function does - defining flags, adding commands, calling the Set*
+// functions - except that it must not call start.Up(). Run resets package
+// start before calling app, and calls start.Up() afterwards.
+//
+// Parameter args contains the command line arguments without the program
+// name. Parameter env contains the environment variables; no other
+// variables are visible to the application. Parameter files maps file paths
+// to file contents. The files live in an in-memory file system whose root
+// serves as both the working directory and the home directory of the
+// application (unless env sets HOME), so {"myapp.toml": "..."} provides a
+// config file in the working directory, and
+// {".config/myapp/config.toml": "..."} one in the user's config directory.
+// Neither the real environment nor the real file system are visible to the
+// config file discovery.
+func Run(app func(), args []string, env map[string]string, files map[string]string) Result {
+	mu.Lock()
+	defer mu.Unlock()
+
+	fsys := fstest.MapFS{}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content), Mode: 0600}
+	}
+	vars := map[string]string{"HOME": "/"}
+	for key, value := range env {
+		vars[key] = value
+	}
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = append([]string{oldArgs[0]}, args...)
+
+	var res Result
+	res.Stdout, res.Stderr = capture(func() {
+		start.ResetState()
+		start.SetFileSystem(fsys)
+		start.SetEnvLookup(func(key string) (string, bool) {
+			value, ok := vars[key]
+			return value, ok
+		})
+		app()
+		start.Up()
+	})
+	res.ExitCode = start.ExitCode()
+	start.ResetState()
+	return res
+}
+
+// Golden compares got with the contents of the file goldenFile and reports
+// a test error if they differ. If the environment variable STARTTEST_UPDATE
+// is set to a non-empty value, Golden writes got to the golden file instead.
+func Golden(t testing.TB, goldenFile string, got string) {
+	t.Helper()
+	if os.Getenv("STARTTEST_UPDATE") != "" {
+		if err := os.WriteFile(goldenFile, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("output does not match golden file %s\n--- got:\n%s\n--- want:\n%s", goldenFile, got, want)
+	}
+}
+
+// capture runs f and returns everything that f writes to os.Stdout and
+// os.Stderr.
+func capture(f func()) (stdout, stderr string) {
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	defer func() {
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+	}()
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return "", err.Error()
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		return "", err.Error()
+	}
+	os.Stdout, os.Stderr = outW, errW
+
+	// Read both pipes concurrently, so that f does not block on a full pipe.
+	var outBuf, errBuf bytes.Buffer
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { io.Copy(&outBuf, outR); wg.Done() }()
+	go func() { io.Copy(&errBuf, errR); wg.Done() }()
+
+	f()
+
+	outW.Close()
+	errW.Close()
+	wg.Wait()
+	return outBuf.String(), errBuf.String()
+}
@@ -0,0 +1,106 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package starttest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/christophberger/start"
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+// greeter is a small test application named "starttest". Setting the name
+// keeps the help output independent of the test executable's name.
+func greeter() {
+	start.SetAppName("starttest")
+	var name string
+	var loud bool
+	flag.StringVarP(&name, "name", "n", "World", "Whom to greet")
+	flag.BoolVarP(&loud, "loud", "l", false, "Greet loudly")
+
+	start.SetDescription("Greets people.")
+	start.Add(&start.Command{
+		Name:  "greet",
+		Short: "Prints a greeting",
+		Long:  "Prints a greeting to stdout.",
+		Flags: []string{"loud"},
+		Cmd: func(cmd *start.Command) error {
+			greeting := "Hello, " + name
+			if loud {
+				greeting += "!!!"
+			}
+			fmt.Println(greeting)
+			return nil
+		},
+	})
+	start.Add(&start.Command{
+		Name:  "fail",
+		Short: "Fails",
+		Long:  "Always returns an error.",
+		Cmd: func(cmd *start.Command) error {
+			return errors.New("failed on purpose")
+		},
+	})
+}
+
+func TestRun(t *testing.T) {
+	Convey("When running a command", t, func() {
+		res := Run(greeter, []string{"greet", "--loud"}, nil, nil)
+
+		Convey("then the result should contain its output and a zero exit code", func() {
+			So(res.Stdout, ShouldEqual, "Hello, World!!!\n")
+			So(res.Stderr, ShouldEqual, "")
+			So(res.ExitCode, ShouldEqual, 0)
+		})
+	})
+
+	Convey("When running a command with a config file and environment variables", t, func() {
+		files := map[string]string{"starttest.toml": `name = "Config"`}
+
+		Convey("then the application should read the config file", func() {
+			res := Run(greeter, []string{"greet"}, nil, files)
+			So(res.Stdout, ShouldEqual, "Hello, Config\n")
+		})
+
+		Convey("then environment variables should override the config file", func() {
+			res := Run(greeter, []string{"greet"}, map[string]string{"STARTTEST_NAME": "Env"}, files)
+			So(res.Stdout, ShouldEqual, "Hello, Env\n")
+		})
+
+		Convey("then the next run should not see the previous run's files or variables", func() {
+			res := Run(greeter, []string{"greet"}, nil, nil)
+			So(res.Stdout, ShouldEqual, "Hello, World\n")
+		})
+	})
+
+	Convey("When a command fails", t, func() {
+		res := Run(greeter, []string{"fail"}, nil, nil)
+
+		Convey("then the result should contain the error and a non-zero exit code", func() {
+			So(res.Stderr, ShouldContainSubstring, "failed on purpose")
+			So(res.ExitCode, ShouldEqual, 1)
+		})
+	})
+
+	Convey("When passing a flag that the command does not accept", t, func() {
+		res := Run(greeter, []string{"fail", "--loud"}, nil, nil)
+
+		Convey("then the exit code should indicate a usage error", func() {
+			So(res.Stderr, ShouldContainSubstring, "Unknown flag")
+			So(res.ExitCode, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestGolden(t *testing.T) {
+	res := Run(greeter, []string{"help"}, nil, nil)
+	Golden(t, "test/help.golden", res.Stderr)
+}
@@ -0,0 +1,129 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// The default streams set via SetStreams(). Nil means the streams of the
+// process.
+var (
+	stdinStream  io.Reader
+	stdoutStream io.Writer
+	stderrStream io.Writer
+)
+
+// The buffered reader for the default stdin stream, and the stream that it
+// reads from. See bufferedStdin().
+var (
+	stdinReader       *bufio.Reader
+	stdinReaderSource io.Reader
+)
+
+// SetStreams sets the default streams for all commands that do not set
+// their own Stdin, Stdout, or Stderr fields, including the built-in
+// commands "help" and "version", and for the messages of this package,
+// like parse errors. A nil stream means the stream of the process
+// (os.Stdin, os.Stdout, or os.Stderr).
+// Tests can use SetStreams to capture the output of an application.
+func SetStreams(stdin io.Reader, stdout, stderr io.Writer) {
+	stdinStream = stdin
+	stdoutStream = stdout
+	stderrStream = stderr
+}
+
+// defaultStdin returns the stdin stream for commands without a stream of
+// their own.
+func defaultStdin() io.Reader {
+	if stdinStream != nil {
+		return stdinStream
+	}
+	return os.Stdin
+}
+
+// bufferedStdin returns a buffered reader for defaultStdin(). The shell and
+// the prompts share this reader, so that neither loses the input that the
+// other has buffered already.
+func bufferedStdin() *bufio.Reader {
+	in := defaultStdin()
+	if stdinReader == nil || stdinReaderSource != in {
+		stdinReader = bufio.NewReader(in)
+		stdinReaderSource = in
+	}
+	return stdinReader
+}
+
+// defaultStdout returns the stdout stream for commands without a stream of
+// their own.
+func defaultStdout() io.Writer {
+	if stdoutStream != nil {
+		return stdoutStream
+	}
+	return os.Stdout
+}
+
+// defaultStderr returns the stderr stream for commands without a stream of
+// their own, and for messages of this package.
+func defaultStderr() io.Writer {
+	if stderrStream != nil {
+		return stderrStream
+	}
+	return os.Stderr
+}
+
+// initStreams sets the streams that the command has not set to the streams
+// of its nearest parent command that has them, or to the default streams.
+// Up() calls initStreams before it executes the command, so that command
+// functions can use cmd.Stdin, cmd.Stdout, and cmd.Stderr directly, and
+// calls the returned function afterwards to restore the original fields.
+// Otherwise, the command would keep the streams of its first run.
+func (cmd *Command) initStreams() (restore func()) {
+	stdin, stdout, stderr := cmd.Stdin, cmd.Stdout, cmd.Stderr
+	cmd.Stdin = cmd.stdin()
+	cmd.Stdout = cmd.stdout()
+	cmd.Stderr = cmd.stderr()
+	return func() {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	}
+}
+
+// stdin returns the stdin stream of the command, its parents, or the
+// default. cmd can be nil.
+func (cmd *Command) stdin() io.Reader {
+	for c := cmd; c != nil; c = c.parent() {
+		if c.Stdin != nil {
+			return c.Stdin
+		}
+	}
+	return defaultStdin()
+}
+
+// stdout returns the stdout stream of the command, its parents, or the
+// default. cmd can be nil.
+func (cmd *Command) stdout() io.Writer {
+	for c := cmd; c != nil; c = c.parent() {
+		if c.Stdout != nil {
+			return c.Stdout
+		}
+	}
+	return defaultStdout()
+}
+
+// stderr returns the stderr stream of the command, its parents, or the
+// default. cmd can be nil.
+func (cmd *Command) stderr() io.Writer {
+	for c := cmd; c != nil; c = c.parent() {
+		if c.Stderr != nil {
+			return c.Stderr
+		}
+	}
+	return defaultStderr()
+}
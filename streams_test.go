@@ -0,0 +1,155 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStreams(t *testing.T) {
+	Convey("Given an application with commands", t, func() {
+		oldArgs := os.Args
+		ResetState()
+		SetEnvLookup(mapEnv(map[string]string{}))
+		var stdout, stderr bytes.Buffer
+		var gotStdin io.Reader
+		Add(&Command{
+			Name:  "parent",
+			Short: "A parent command",
+		})
+		Add(&Command{
+			Name:   "child",
+			Parent: "parent",
+			Short:  "A child command",
+			Cmd: func(cmd *Command) error {
+				gotStdin = cmd.Stdin
+				data, err := io.ReadAll(cmd.Stdin)
+				if err != nil {
+					return err
+				}
+				fmt.Fprint(cmd.Stdout, strings.ToUpper(string(data)))
+				return errors.New("failed on purpose")
+			},
+		})
+		Add(&Command{
+			Name:  "list",
+			Short: "Prints a list",
+			Long:  "Prints a list of values.",
+			Cmd: func(cmd *Command) error {
+				return cmd.Print([]map[string]int{{"a": 1}})
+			},
+		})
+
+		Convey("SetStreams should redirect the version", func() {
+			SetStreams(nil, &stdout, &stderr)
+			os.Args = []string{os.Args[0], "version"}
+			Up()
+			So(stderr.String(), ShouldEqual, displayName()+" version 1.0\n")
+			So(stdout.String(), ShouldEqual, "")
+		})
+
+		Convey("SetStreams should redirect the help", func() {
+			SetStreams(nil, &stdout, &stderr)
+			os.Args = []string{os.Args[0], "help", "list"}
+			Up()
+			So(stderr.String(), ShouldContainSubstring, "Prints a list of values.")
+		})
+
+		Convey("SetStreams should redirect errors", func() {
+			SetStreams(nil, &stdout, &stderr)
+			os.Args = []string{os.Args[0], "parent"}
+			Up()
+			So(stderr.String(), ShouldContainSubstring, "Error while reading a command:")
+		})
+
+		Convey("Print should write to the command's Stdout", func() {
+			Commands["list"].Stdout = &stdout
+			os.Args = []string{os.Args[0], "list"}
+			Up()
+			So(ExitCode(), ShouldEqual, 0)
+			So(stdout.String(), ShouldEqual, "A\n1\n")
+		})
+
+		Convey("a subcommand should inherit the streams of its parent", func() {
+			parent := Commands["parent"]
+			parent.Stdin = strings.NewReader("input")
+			parent.Stdout = &stdout
+			parent.Stderr = &stderr
+			os.Args = []string{os.Args[0], "parent", "child"}
+			Up()
+			So(gotStdin, ShouldEqual, parent.Stdin)
+			So(Commands["parent"].children["child"].Stdin, ShouldBeNil)
+			So(stdout.String(), ShouldEqual, "INPUT")
+			So(stderr.String(), ShouldContainSubstring, "failed on purpose")
+			So(ExitCode(), ShouldEqual, exitError)
+		})
+
+		Convey("a second run should use the streams of SetStreams() again", func() {
+			var first, second bytes.Buffer
+			SetStreams(nil, &first, nil)
+			os.Args = []string{os.Args[0], "list"}
+			Up()
+			SetStreams(nil, &second, nil)
+			So(Reparse(), ShouldBeNil)
+			So(runCommand(Commands["list"]), ShouldBeNil)
+			So(first.String(), ShouldEqual, "A\n1\n")
+			So(second.String(), ShouldEqual, "A\n1\n")
+			So(Commands["list"].Stdout, ShouldBeNil)
+		})
+
+		Convey("Usage should write to the command's Stderr", func() {
+			Commands["list"].Stderr = &stderr
+			So(Usage(Commands["list"]), ShouldBeNil)
+			So(stderr.String(), ShouldContainSubstring, "Prints a list of values.")
+		})
+
+		Reset(func() {
+			os.Args = oldArgs
+			ResetState()
+		})
+	})
+
+	Convey("The shell and the prompts should share one buffer for stdin", t, func() {
+		ResetState()
+		SetStreams(strings.NewReader("greet\nJoe\n"), nil, nil)
+		in := newLineReader()
+		line, err := in.readLine("> ")
+		So(err, ShouldBeNil)
+		So(line, ShouldEqual, "greet")
+		answer, err := bufferedStdin().ReadString('\n')
+		So(err, ShouldBeNil)
+		So(answer, ShouldEqual, "Joe\n")
+
+		Convey("until SetStreams sets another stdin", func() {
+			SetStreams(strings.NewReader("other\n"), nil, nil)
+			answer, err := bufferedStdin().ReadString('\n')
+			So(err, ShouldBeNil)
+			So(answer, ShouldEqual, "other\n")
+		})
+
+		Reset(func() {
+			ResetState()
+		})
+	})
+
+	Convey("Without SetStreams, the defaults should be the OS streams", t, func() {
+		ResetState()
+		var cmd *Command
+		So(cmd.stdin(), ShouldEqual, os.Stdin)
+		So(cmd.stdout(), ShouldEqual, os.Stdout)
+		So(cmd.stderr(), ShouldEqual, os.Stderr)
+	})
+}
@@ -8,11 +8,13 @@
 package start
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"regexp"
-	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/laurent22/toml-go"
 )
@@ -20,16 +22,276 @@ import (
 // NewconfigFile creates a new configFile struct filled with the contents
 // of the file identified by filename.
 // Parameter filename can be an empty string, a file name, or a fully qualified path.
+// Unless filename is an absolute path, newConfigFile also reads the config
+// files from the system config dirs as lower-precedence layers.
+// Files listed in the top-level "include" key of a config file become layers
+// of that file (see readIncludes).
 func newConfigFile(filename string) (*configFile, error) { // TODO: Do not return an error. See start.go > parse()
 	cfg := &configFile{}
 	err := cfg.findAndReadTomlFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+	if err = cfg.readIncludes(map[string]bool{}); err != nil {
+		return cfg, err
+	}
+	if !filepath.IsAbs(filename) {
+		err = cfg.readSystemConfigFiles(filename)
+	}
 	return cfg, err
 }
 
+// emptyConfigFile returns a configFile without any content.
+func emptyConfigFile() *configFile {
+	var parser toml.Parser
+	return &configFile{doc: parser.Parse("")}
+}
+
+// readLayer reads the config file at path, including the files it includes.
+func readLayer(path string) (*configFile, error) {
+	layer := &configFile{}
+	var err error
+	layer.doc, err = layer.readTomlFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return layer, layer.readIncludes(map[string]bool{})
+}
+
+// readSystemConfigFiles adds the config files found in the system config
+// dirs as layers, in order of precedence. Missing files are skipped.
+func (c *configFile) readSystemConfigFiles(name string) error {
+	if len(name) == 0 {
+		name = "config.toml"
+	}
+	for _, dir := range GetSystemConfigDirs() {
+		path := filepath.Join(dir, name)
+		if _, err := statFile(path); err != nil {
+			continue
+		}
+		layer, err := readLayer(path)
+		if err != nil {
+			return err
+		}
+		c.layers = append(c.layers, layer)
+	}
+	return nil
+}
+
+// readIncludes reads the files listed in the top-level key "include" and
+// inserts them as layers directly below the config file itself, so they
+// provide the values that the including file does not define.
+// The key takes a string or an array of strings. Relative paths are relative
+// to the directory of the including file. Included files can include other
+// files; seen contains the files on the current include chain to detect cycles.
+func (c *configFile) readIncludes(seen map[string]bool) error {
+	if len(c.path) == 0 {
+		return nil
+	}
+	seen[c.path] = true
+	defer delete(seen, c.path)
+
+	value, exists := c.get("include")
+	if !exists {
+		return nil
+	}
+	var names []string
+	switch valueKind(value) {
+	case kindString:
+		names = []string{value.AsString()}
+	case kindArray:
+		for _, v := range value.AsArray() {
+			names = append(names, v.AsString())
+		}
+	default:
+		return errors.New(c.path + ": include must be a string or an array of strings")
+	}
+
+	var includes []*configFile
+	for _, name := range names {
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(c.path), name)
+		}
+		if seen[path] {
+			return errors.New(c.path + ": include cycle: " + path + " includes itself")
+		}
+		include := &configFile{}
+		var err error
+		include.doc, err = include.readTomlFile(path)
+		if err != nil {
+			return errors.New(c.path + ": cannot include " + name + ": " + err.Error())
+		}
+		if err = include.readIncludes(seen); err != nil {
+			return err
+		}
+		includes = append(includes, include)
+	}
+	c.layers = append(includes, c.layers...)
+	return nil
+}
+
+// value returns the value of key "name". If a profile is selected, the value
+// from the profile section [profile.<name>] of the config file or of any
+// layer takes precedence. Otherwise, value returns the top-level value from
+// the config file itself or, if the config file does not contain the key,
+// from the first layer that does.
+func (c *configFile) value(name string) (toml.Value, bool) {
+	s, exists := c.setting(name)
+	return s.value, exists
+}
+
+// setting is a value from a config file, along with the file and the full
+// key where it was found.
+type setting struct {
+	value toml.Value
+	file  *configFile
+	key   string
+}
+
+// setting works like value but also returns where the value was found.
+func (c *configFile) setting(name string) (setting, bool) {
+	if len(c.profile) > 0 {
+		key := profileSection(c.profile) + "." + name
+		if s, exists := c.lookup(key); exists {
+			return s, true
+		}
+	}
+	return c.lookup(name)
+}
+
+// lookup returns the value of key from the config file itself or, if the
+// config file does not contain the key, from the first layer that does.
+func (c *configFile) lookup(key string) (setting, bool) {
+	if value, exists := c.get(key); exists {
+		return setting{value: value, file: c, key: key}, true
+	}
+	for _, layer := range c.layers {
+		if s, exists := layer.lookup(key); exists {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// get returns the value of key from the config file itself. The key may be
+// a dotted path into a section, like "server.port". Sections are not values,
+// so get returns false for them.
+func (c *configFile) get(key string) (toml.Value, bool) {
+	// toml-go's GetValue loops forever if the section of a dotted key
+	// does not exist, so check for the section first.
+	if i := strings.LastIndex(key, "."); i >= 0 && !c.hasSection(key[:i]) {
+		return toml.Value{}, false
+	}
+	value, exists := c.doc.GetValue(key)
+	if !exists || valueKind(value) == kindNone {
+		return toml.Value{}, false
+	}
+	return value, true
+}
+
+// hasSection returns true if the config file itself contains the section
+// at the given dotted path, including implicitly defined parent sections.
+func (c *configFile) hasSection(path string) bool {
+	if c.sections == nil {
+		c.sections = tomlSections(c.doc)
+	}
+	return c.sections[path]
+}
+
+// line returns the line number of the dotted key in the config file itself,
+// or 0 if the key cannot be found. toml-go does not record line numbers, so
+// line scans the raw lines of the file for the section and the key.
+func (c *configFile) line(key string) int {
+	section, name := "", key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		section, name = key[:i], key[i+1:]
+	}
+	current := ""
+	for i, l := range c.lines {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "[") && strings.HasSuffix(l, "]") {
+			current = strings.TrimSpace(l[1 : len(l)-1])
+			continue
+		}
+		eq := strings.Index(l, "=")
+		if current == section && eq > 0 && strings.Trim(strings.TrimSpace(l[:eq]), "\"") == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// hasProfile returns true if the config file or any of its layers contains
+// the section for the given profile.
+func (c *configFile) hasProfile(profile string) bool {
+	if c.hasSection(profileSection(profile)) {
+		return true
+	}
+	for _, layer := range c.layers {
+		if layer.hasProfile(profile) {
+			return true
+		}
+	}
+	return false
+}
+
+// profileSection returns the path of the section for the given profile.
+func profileSection(profile string) string {
+	return "profile." + profile
+}
+
+// tomlSections returns the full paths of all sections of doc.
+// toml-go does not provide access to the list of sections, but the
+// document's String() method lists each section as "[path]" on its own line.
+func tomlSections(doc toml.Document) map[string]bool {
+	sections := map[string]bool{}
+	for _, line := range strings.Split(doc.String(), "\n") {
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			sections[line[1:len(line)-1]] = true
+		}
+	}
+	return sections
+}
+
+// Kinds of TOML values. toml-go does not export the kind of a value,
+// so valueKind derives it from the value's string representation.
+const (
+	kindNone = iota // not a value, e.g. a section or an unparsable value
+	kindString
+	kindBool
+	kindInt
+	kindFloat
+	kindDate
+	kindArray
+)
+
+// valueKind returns the kind of a TOML value.
+func valueKind(value toml.Value) int {
+	s := value.String()
+	switch {
+	case s == "undefined":
+		return kindNone
+	case strings.HasPrefix(s, "\""):
+		return kindString
+	case strings.HasPrefix(s, "["):
+		return kindArray
+	case s == "true" || s == "false":
+		return kindBool
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return kindInt
+	}
+	if _, err := time.Parse(time.RFC3339, s); err == nil {
+		return kindDate
+	}
+	return kindFloat
+}
+
 // String returns the value of key "name" as a string.
 // Keys must be defined outside any section in the TOML file.
 func (c *configFile) String(name string) string {
-	value, exists := c.doc.GetValue(name)
+	value, exists := c.value(name)
 	// Note: c.doc.GetString() does not work here as this
 	// returns "" for all non-string values.
 	// GetValue().String(), on the other hand, does work for
@@ -43,12 +305,30 @@ func (c *configFile) String(name string) string {
 }
 
 // Path returns the path to the config file, if one was found.
+// If only layers were found, it returns the path of the first layer.
 // Otherwise it returns an empty path.
 func (c *configFile) Path() string {
-	if c == nil {
+	paths := c.Paths()
+	if len(paths) == 0 {
 		return ""
 	}
-	return c.path
+	return paths[0]
+}
+
+// Paths returns the paths of the config file and all of its layers that
+// were found, in order of precedence.
+func (c *configFile) Paths() []string {
+	if c == nil {
+		return nil
+	}
+	var paths []string
+	if len(c.path) > 0 {
+		paths = append(paths, c.path)
+	}
+	for _, layer := range c.layers {
+		paths = append(paths, layer.Paths()...)
+	}
+	return paths
 }
 
 // Toml returns the toml document created from the config file,
@@ -65,7 +345,7 @@ func (c *configFile) findAndReadTomlFile(name string) error {
 
 	// is name an absolute path? If so, go ahead and read the file.
 	if filepath.IsAbs(name) {
-		fileInfo, err := os.Stat(name)
+		fileInfo, err := statFile(name)
 		if err == nil {
 			if fileInfo.IsDir() {
 				c.doc, err = c.readTomlFile(filepath.Join(name, appName()+".toml"))
@@ -80,10 +360,12 @@ func (c *configFile) findAndReadTomlFile(name string) error {
 	// is the environment variable <APPNAME>_CFGPATH set
 	// (either to a dir path or to a file path)?
 	// CAVEAT: this does not work with "go run" as appName() would be wrong then
-	cfgPath := os.Getenv(strings.ToUpper(appName() + "_CFGPATH"))
+	cfgPath := getenv(appEnvName("CFGPATH"))
 	if len(cfgPath) > 0 {
 		if len(name) > 0 {
 			cfgPath = filepath.Join(cfgPath, name)
+		} else if fileInfo, err := statFile(cfgPath); err == nil && fileInfo.IsDir() {
+			cfgPath = filepath.Join(cfgPath, appName()+".toml")
 		}
 		c.doc, err = c.readTomlFile(cfgPath)
 		if err == nil {
@@ -91,18 +373,26 @@ func (c *configFile) findAndReadTomlFile(name string) error {
 		}
 	}
 
+	// if enabled, search for a project config file in the working dir and
+	// its parents. The user's config file then becomes a layer.
+	if searchParents {
+		wd, err := getwd()
+		if err == nil && c.findInParentDirs(wd, name) {
+			return c.readUserConfigLayer(name)
+		}
+	}
+
 	// environment variable is not set, or the config file was not found there,
-	// so try the working dir instead
 	// so search the config file in the user config dir
 	// (e.g. ~/.config/<application>/config.toml on Unixes).
 	cfgPath, _ = GetUserConfigDir()
 	if len(cfgPath) > 0 {
-		if len(name) == 0 {
+		cfgName := name
+		if len(cfgName) == 0 {
 			// no name supplied; use config.toml
-			name = "config.toml"
+			cfgName = "config.toml"
 		}
-		path := filepath.Join(cfgPath, name)
-		c.doc, err = c.readTomlFile(path)
+		c.doc, err = c.readTomlFile(filepath.Join(cfgPath, cfgName))
 		if err == nil {
 			return nil
 		}
@@ -110,7 +400,8 @@ func (c *configFile) findAndReadTomlFile(name string) error {
 
 	// did not find a config file in the user's config dir,
 	// or did not find a config dir at all,
-	cfgPath, err = os.Getwd()
+	// so try the working dir instead.
+	cfgPath, err = getwd()
 	if err == nil {
 		if len(name) == 0 {
 			name = appName() + ".toml"
@@ -128,60 +419,104 @@ func (c *configFile) findAndReadTomlFile(name string) error {
 	return err
 }
 
+// findInParentDirs searches dir and its parent dirs for a config file named
+// name, or <appname>.toml or .<appname>.toml if name is empty, and reads the
+// first one found. The search stops at the file system root or after a dir
+// that contains one of the root markers.
+func (c *configFile) findInParentDirs(dir, name string) bool {
+	names := []string{name}
+	if len(name) == 0 {
+		names = []string{appName() + ".toml", "." + appName() + ".toml"}
+	}
+	for {
+		for _, n := range names {
+			doc, err := c.readTomlFile(filepath.Join(dir, n))
+			if err == nil {
+				c.doc = doc
+				return true
+			}
+		}
+		if hasRootMarker(dir) {
+			return false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
+
+// hasRootMarker returns true if dir contains one of the root markers.
+func hasRootMarker(dir string) bool {
+	for _, marker := range rootMarkers {
+		if _, err := statFile(filepath.Join(dir, marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// readUserConfigLayer adds the config file from the user's config dir,
+// if any, as a layer.
+func (c *configFile) readUserConfigLayer(name string) error {
+	dir, exists := GetUserConfigDir()
+	if !exists {
+		return nil
+	}
+	if len(name) == 0 {
+		name = "config.toml"
+	}
+	path := filepath.Join(dir, name)
+	if _, err := statFile(path); err != nil {
+		return nil
+	}
+	layer, err := readLayer(path)
+	if err != nil {
+		return err
+	}
+	c.layers = append(c.layers, layer)
+	return nil
+}
+
 func (c *configFile) readTomlFile(path string) (toml.Document, error) {
 	var parser toml.Parser
-	var err error
 	emptyDoc := parser.Parse("") // empty default TOML document required to fix a runtime panic
-	if _, err = os.Stat(path); err == nil {
-		c.path = path
-		return parser.ParseFile(path), nil
-	}
-	return emptyDoc, err
-}
-
-// GetUserConfigDir finds the user's config directory in an OS-independent way.
-// "OS-independent" means compatible with most Unix-like operating systems as well as with Microsoft Windows(TM).
-// The boolean return value indicates if the directory exists at the location determined
-// via environment variables.
-func GetUserConfigDir() (dir string, exists bool) {
-	// Credits for this OS-independent solution go to Stackoverflow user peterSO
-	// (see http://stackoverflow.com/a/7922977). I just modified it a bit to
-	// get the respective config dir instead of the home dir.
-	// Using os.User is not an option here. It relies on CGO and thus prevents
-	// cross compiling.
-	if runtime.GOOS == "windows" {
-		dir = filepath.Join(os.Getenv("LOCALAPPDATA"), appName())
-	} else {
-		// Linuxes may have this config env var defined.
-		dir = os.Getenv("XDG_CONFIG_HOME")
-		if dir == "" {
-			// else use the common ~/.config/<appname>/ convention.
-			dir = filepath.Join(os.Getenv("HOME"), ".config", appName())
-		}
-	}
-	// verify if the config dir exists in the file system
-	exists = true
-	_, err := os.Stat(dir)
-	if os.IsNotExist(err) {
-		exists = false
-	}
-	return dir, exists
-}
-
-// appName returns the name of the application, with path and extension stripped off,
+	content, err := readFile(path)
+	if err != nil {
+		return emptyDoc, err
+	}
+	c.path = path
+	c.lines = strings.Split(string(content), "\n")
+	return parser.Parse(string(content)), nil
+}
+
+// appName returns the name of the application: the name set via
+// SetAppName(), or the default name from defaultAppName().
+func appName() string {
+	if App == "" {
+		App = defaultAppName()
+	}
+	return App
+}
+
+// defaultAppName returns the name of the executable, with path and extension stripped off,
 // and all characters other than ASCII letters, numbers, or underscores, replaced by
 // underscores.
 // Replacing special characters by underscores makes the returned name suitable for
 // being used in the name of an environment variable.
-// appName does all this only once and returns the created app name on subsequent calls.
-func appName() string {
-	if App == "" {
-		fileName := filepath.Base(os.Args[0])
-		fileExt := filepath.Ext(fileName)
-		if len(fileExt) > 0 {
-			fileName = strings.Split(fileName, ".")[0]
-		}
-		App = regexp.MustCompile("[^a-zA-Z0-9_]").ReplaceAllString(fileName, "_")
+func defaultAppName() string {
+	fileName := invocationName()
+	return regexp.MustCompile("[^a-zA-Z0-9_]").ReplaceAllString(fileName, "_")
+}
+
+// invocationName returns the name that the application was invoked with,
+// with path and extension stripped off.
+func invocationName() string {
+	fileName := filepath.Base(os.Args[0])
+	fileExt := filepath.Ext(fileName)
+	if len(fileExt) > 0 {
+		fileName = strings.Split(fileName, ".")[0]
 	}
-	return App
+	return fileName
 }
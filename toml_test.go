@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/laurent22/toml-go"
@@ -229,3 +230,141 @@ func TestConfigFile(t *testing.T) {
 		})
 	})
 }
+
+func TestSearchParentDirs(t *testing.T) {
+	Convey("Given a project with config files in parent dirs of the working dir", t, func() {
+		SetFileSystem(fstest.MapFS{
+			"start.toml":                       {Data: []byte(`where = "outside"`)},
+			"home/u/.config/start/config.toml": {Data: []byte("where = \"user\"\nuser = \"user\"")},
+			"home/u/repo/.git/HEAD":            {Data: []byte("ref: refs/heads/main")},
+			"home/u/repo/.start.toml":          {Data: []byte(`where = "repo"`)},
+			"home/u/repo/sub/dir/readme.txt":   {Data: []byte("no config here")},
+			"home/u/other/sub/readme.txt":      {Data: []byte("no config here")},
+		})
+		SetEnvLookup(mapEnv(map[string]string{"HOME": "/home/u", "LOCALAPPDATA": "/home/u/.config"}))
+		SetWorkingDir(filepath.FromSlash("/home/u/repo/sub/dir"))
+
+		Convey("without enabling the search, the project config file should not be found", func() {
+			cfg, _ := newConfigFile("")
+			So(cfg.String("where"), ShouldEqual, "user")
+		})
+
+		Convey("with the search enabled", func() {
+			SearchParentDirs()
+
+			Convey("the project config file should be found in a parent dir", func() {
+				cfg, _ := newConfigFile("")
+				So(cfg.String("where"), ShouldEqual, "repo")
+				So(cfg.Path(), ShouldEqual, filepath.FromSlash("/home/u/repo/.start.toml"))
+
+				Convey("and the user's config file should provide the remaining values", func() {
+					So(cfg.String("user"), ShouldEqual, "user")
+				})
+			})
+
+			Convey("the search should stop at the root marker", func() {
+				SearchParentDirs("readme.txt")
+				cfg, _ := newConfigFile("")
+				So(cfg.String("where"), ShouldEqual, "user")
+			})
+
+			Convey("the search should continue up to the root if there is no marker", func() {
+				SetWorkingDir(filepath.FromSlash("/home/u/other/sub"))
+				cfg, _ := newConfigFile("")
+				So(cfg.String("where"), ShouldEqual, "outside")
+			})
+		})
+
+		Reset(func() {
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+			SetWorkingDir("")
+			searchParents = false
+			rootMarkers = nil
+		})
+	})
+}
+
+func TestIncludes(t *testing.T) {
+	Convey("Given config files that include other config files", t, func() {
+		fsys := fstest.MapFS{
+			"app/start.toml": {Data: []byte(`include = ["common.toml", "/shared/base.toml"]
+name = "main"`)},
+			"app/common.toml":      {Data: []byte("include = \"nested/deep.toml\"\nname = \"common\"\ncommon = \"common\"")},
+			"app/nested/deep.toml": {Data: []byte("deep = \"deep\"\ncommon = \"deep\"")},
+			"shared/base.toml":     {Data: []byte("base = \"base\"\ncommon = \"base\"")},
+			"cycle/a.toml":         {Data: []byte(`include = "b.toml"`)},
+			"cycle/b.toml":         {Data: []byte(`include = "a.toml"`)},
+			"missing/start.toml":   {Data: []byte(`include = "nothere.toml"`)},
+		}
+		SetFileSystem(fsys)
+		SetEnvLookup(mapEnv(map[string]string{}))
+
+		Convey("the including file should take precedence over the included files", func() {
+			cfg, err := newConfigFile(filepath.FromSlash("/app/start.toml"))
+			So(err, ShouldBeNil)
+			So(cfg.String("name"), ShouldEqual, "main")
+
+			Convey("and included files should be resolved relative to the including file", func() {
+				So(cfg.String("common"), ShouldEqual, "common")
+				So(cfg.String("deep"), ShouldEqual, "deep")
+				So(cfg.String("base"), ShouldEqual, "base")
+				So(cfg.Paths(), ShouldResemble, []string{
+					filepath.FromSlash("/app/start.toml"),
+					filepath.FromSlash("/app/common.toml"),
+					filepath.FromSlash("/app/nested/deep.toml"),
+					filepath.FromSlash("/shared/base.toml"),
+				})
+			})
+		})
+
+		Convey("an include cycle should be reported", func() {
+			_, err := newConfigFile(filepath.FromSlash("/cycle/a.toml"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "include cycle")
+		})
+
+		Convey("a missing include file should be reported", func() {
+			_, err := newConfigFile(filepath.FromSlash("/missing/start.toml"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "nothere.toml")
+		})
+
+		Reset(func() {
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+		})
+	})
+}
+
+func TestValueKind(t *testing.T) {
+	Convey("Given a TOML document with values of all kinds", t, func() {
+		var parser toml.Parser
+		doc := parser.Parse(`s = "text"
+b = true
+i = 42
+f = 4.2
+d = 2014-08-17T09:25:00Z
+a = ["x", "y"]
+[section]
+key = 1`)
+		kind := func(key string) int {
+			v, _ := doc.GetValue(key)
+			return valueKind(v)
+		}
+
+		Convey("valueKind should identify each kind", func() {
+			So(kind("s"), ShouldEqual, kindString)
+			So(kind("b"), ShouldEqual, kindBool)
+			So(kind("i"), ShouldEqual, kindInt)
+			So(kind("f"), ShouldEqual, kindFloat)
+			So(kind("d"), ShouldEqual, kindDate)
+			So(kind("a"), ShouldEqual, kindArray)
+			So(kind("section"), ShouldEqual, kindNone)
+		})
+
+		Convey("tomlSections should find all sections", func() {
+			So(tomlSections(doc), ShouldResemble, map[string]bool{"section": true})
+		})
+	})
+}
@@ -0,0 +1,271 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	defaultPollInterval = 2 * time.Second
+	// reloadDelay collects the bursts of file events that editors cause
+	// when saving a file into a single reload.
+	reloadDelay = 100 * time.Millisecond
+)
+
+var (
+	watchConfig       bool
+	configChangeFuncs []func(changed []string)
+	pollInterval      = defaultPollInterval
+)
+
+// WatchConfig enables live reloading of the config file. While a command
+// runs, Up() watches the config files that it has read (see
+// ConfigFilePaths()), and reloads them when they change or when the
+// application receives SIGHUP.
+// A reload updates all flags that were not set on the command line or
+// through an environment variable, as these sources take precedence.
+// Flags whose key has been removed from the config file return to their
+// default value. If the new config file contains invalid values or
+// violates a rule (see Require()), the flags keep their previous values.
+// On Linux, the watcher uses inotify; on other systems, or if inotify is
+// not available, or if the file system has been replaced via
+// SetFileSystem(), it polls the files every two seconds.
+// Note that flag variables change while the command runs. Use
+// OnConfigChange() to get notified, and Settings() to read the values
+// safely from any goroutine.
+// Call WatchConfig before Up().
+func WatchConfig() {
+	watchConfig = true
+}
+
+// OnConfigChange registers a function that gets called after a reload of
+// the config file has changed the values of flags. Parameter changed
+// contains the names of these flags.
+// The function runs on a separate goroutine.
+func OnConfigChange(f func(changed []string)) {
+	configChangeFuncs = append(configChangeFuncs, f)
+}
+
+// startWatching reloads the config file when one of the config files
+// changes or when the application receives SIGHUP, until ctx is done or
+// the returned stop function gets called.
+func startWatching(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	events := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case events <- struct{}{}:
+		default: // a reload is pending already
+		}
+	}
+	watchFiles(ctx, ConfigFilePaths(), notify)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+			case <-events:
+				time.Sleep(reloadDelay)
+				select {
+				case <-events:
+				default:
+				}
+			}
+			if err := reloadConfig(); err != nil {
+				errPrintln("Error while reloading the config file:")
+				errPrintln(err)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hup)
+		cancel()
+		<-done
+	}
+}
+
+// pollFiles calls notify whenever the modification time or the size of one
+// of the files changes, until ctx is done.
+func pollFiles(ctx context.Context, paths []string, notify func()) {
+	type fileState struct {
+		modTime time.Time
+		size    int64
+		exists  bool
+	}
+	stat := func() map[string]fileState {
+		states := map[string]fileState{}
+		for _, path := range paths {
+			if info, err := statFile(path); err == nil {
+				states[path] = fileState{info.ModTime(), info.Size(), true}
+			}
+		}
+		return states
+	}
+	last := stat()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := stat()
+			for _, path := range paths {
+				if current[path] != last[path] {
+					notify()
+					break
+				}
+			}
+			last = current
+		}
+	}
+}
+
+// watchedNames returns the dirs that contain the given files, along with
+// the file names to watch in each dir. Watching the dirs rather than the
+// files catches editors that replace a file instead of writing to it.
+func watchedNames(paths []string) map[string]map[string]bool {
+	dirs := map[string]map[string]bool{}
+	for _, path := range paths {
+		dir, name := filepath.Split(path)
+		dir = filepath.Clean(dir)
+		if dirs[dir] == nil {
+			dirs[dir] = map[string]bool{}
+		}
+		dirs[dir][name] = true
+	}
+	return dirs
+}
+
+// reloadConfig reads the config file again and applies it to all flags that
+// neither the command line nor an environment variable has set. If any
+// value is invalid, reloadConfig restores the previous values and returns
+// an error. Afterwards, it calls the functions registered via
+// OnConfigChange() with the names of the flags whose values have changed.
+// The functions run after the reload has released parseMu, so they can call
+// DecodeConfig() or Reparse().
+func reloadConfig() error {
+	changed, funcs, err := reloadFlags()
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		for _, f := range funcs {
+			f(changed)
+		}
+	}
+	return nil
+}
+
+// reloadFlags does the work of reloadConfig while holding parseMu. It
+// returns the sorted names of the changed flags and the functions to call.
+func reloadFlags() ([]string, []func(changed []string), error) {
+	parseMu.Lock()
+	defer parseMu.Unlock()
+
+	cfg, err := readConfigFile(parsedArgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	oldCfg := cfgFile
+	oldValues := map[string]string{}
+	oldDefValues := map[string]string{}
+	oldSources := map[string]string{}
+	for name, source := range flagSources {
+		oldSources[name] = source
+	}
+	restore := func() {
+		for name, value := range oldValues {
+			f := flag.Lookup(name)
+			resetValue(f, value)
+			f.DefValue = oldDefValues[name]
+		}
+		flagSources = oldSources
+		cfgFile = oldCfg
+	}
+
+	cfgFile = cfg
+	var changed []string
+	flag.VisitAll(func(f *flag.Flag) {
+		if isConfigFlag(f) || err != nil {
+			return
+		}
+		source := flagSource(f.Name)
+		if source == "command line" || strings.HasPrefix(source, "environment variable") {
+			return
+		}
+		oldValues[f.Name] = f.Value.String()
+		oldDefValues[f.Name] = f.DefValue
+		delete(flagSources, f.Name)
+		err = applyConfig(cfgFile, f)
+		if err == nil && !isSet(f.Name) && source != "default" {
+			// the key has been removed from the config file
+			f.DefValue = originalDefault(f)
+			err = resetValue(f, f.DefValue)
+		}
+		setDefValue(f)
+		if f.Value.String() != oldValues[f.Name] {
+			changed = append(changed, f.Name)
+		}
+	})
+	if err == nil {
+		err = checkConstraints()
+	}
+	if err != nil {
+		restore()
+		return nil, nil, err
+	}
+	updateLogLevel()
+	publishSettings()
+	logConfigFiles("Reloaded")
+	sort.Strings(changed)
+	funcs := make([]func(changed []string), len(configChangeFuncs))
+	copy(funcs, configChangeFuncs)
+	return changed, funcs, nil
+}
+
+// resetValue sets the flag to a value in the format of the flag's String()
+// method, replacing the current value of slice flags.
+func resetValue(f *flag.Flag, value string) error {
+	if sv, isSlice := f.Value.(flag.SliceValue); isSlice {
+		var vals []string
+		inner := strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+		if len(inner) > 0 {
+			var err error
+			if vals, err = splitList(inner); err != nil {
+				return errors.New("Cannot reset flag --" + f.Name + ": " + err.Error())
+			}
+		}
+		return sv.Replace(vals)
+	}
+	if isMapFlag(f) {
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+		if len(value) == 0 {
+			return clearMap(f.Value)
+		}
+		return setMap(f, value)
+	}
+	return f.Value.Set(value)
+}
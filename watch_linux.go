@@ -0,0 +1,77 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// watchFiles starts a goroutine that calls notify whenever one of the files
+// changes, until ctx is done. It uses inotify, or polls the files if inotify
+// is not available or if the files are not on the operating system's file
+// system.
+func watchFiles(ctx context.Context, paths []string, notify func()) {
+	if fileSystem == nil && len(paths) > 0 {
+		if run, err := inotifyFiles(paths, notify); err == nil {
+			go run(ctx)
+			return
+		}
+	}
+	go pollFiles(ctx, paths, notify)
+}
+
+// inotifyFiles sets up inotify watches for the files. It returns a function
+// that processes the events until ctx is done, or an error if it cannot set
+// up the watches.
+func inotifyFiles(paths []string, notify func()) (run func(ctx context.Context), err error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	// A non-blocking file is managed by the runtime poller, so closing it
+	// unblocks a pending Read.
+	file := os.NewFile(uintptr(fd), "inotify")
+
+	const mask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY
+	dirs := map[int]map[string]bool{}
+	for dir, names := range watchedNames(paths) {
+		wd, err := syscall.InotifyAddWatch(fd, dir, mask)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		dirs[wd] = names
+	}
+
+	return func(ctx context.Context) {
+		go func() {
+			<-ctx.Done()
+			file.Close()
+		}()
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				return // closed
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				start := offset + syscall.SizeofInotifyEvent
+				name := string(bytes.TrimRight(buf[start:start+int(event.Len)], "\x00"))
+				if dirs[int(event.Wd)][name] {
+					notify()
+				}
+				offset = start + int(event.Len)
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestWatchConfig(t *testing.T) {
+	Convey("Given a watched config file", t, func() {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		configChangeFuncs = nil
+		name := flag.String("name", "default", "")
+		path := filepath.Join(t.TempDir(), "start.toml")
+		So(os.WriteFile(path, []byte(`name = "old"`), 0o600), ShouldBeNil)
+		SetEnvLookup(mapEnv(map[string]string{}))
+		os.Args = []string{os.Args[0], "--config", path}
+		So(Reparse(), ShouldBeNil)
+		So(*name, ShouldEqual, "old")
+
+		changes := make(chan []string, 1)
+		OnConfigChange(func(changed []string) { changes <- changed })
+		stop := startWatching(context.Background())
+
+		waitForChange := func() []string {
+			select {
+			case changed := <-changes:
+				return changed
+			case <-time.After(5 * time.Second):
+				return nil
+			}
+		}
+
+		Convey("writing the file should reload it via inotify", func() {
+			So(os.WriteFile(path, []byte(`name = "new"`), 0o600), ShouldBeNil)
+			So(waitForChange(), ShouldResemble, []string{"name"})
+			So(*name, ShouldEqual, "new")
+		})
+
+		Convey("replacing the file should reload it", func() {
+			tmp := path + ".tmp"
+			So(os.WriteFile(tmp, []byte(`name = "replaced"`), 0o600), ShouldBeNil)
+			So(os.Rename(tmp, path), ShouldBeNil)
+			So(waitForChange(), ShouldResemble, []string{"name"})
+			So(*name, ShouldEqual, "replaced")
+		})
+
+		Convey("SIGHUP should reload the file", func() {
+			stop()
+			// Change the file while nobody watches it.
+			So(os.WriteFile(path, []byte(`name = "hup"`), 0o600), ShouldBeNil)
+			stop = startWatching(context.Background())
+			So(syscall.Kill(os.Getpid(), syscall.SIGHUP), ShouldBeNil)
+			So(waitForChange(), ShouldResemble, []string{"name"})
+			So(*name, ShouldEqual, "hup")
+		})
+
+		Reset(func() {
+			stop()
+			configChangeFuncs = nil
+			SetEnvLookup(nil)
+		})
+	})
+}
@@ -0,0 +1,19 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+//go:build !linux
+// +build !linux
+
+package start
+
+import "context"
+
+// watchFiles starts a goroutine that calls notify whenever one of the files
+// changes, until ctx is done. On this operating system, it polls the files.
+func watchFiles(ctx context.Context, paths []string, notify func()) {
+	go pollFiles(ctx, paths, notify)
+}
@@ -0,0 +1,152 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	flag "github.com/spf13/pflag"
+)
+
+func TestReloadConfig(t *testing.T) {
+	Convey("Given flags from all sources", t, func() {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		configChangeFuncs = nil
+		fromConfig := flag.String("fromconfig", "default", "")
+		fromCmdline := flag.String("fromcmdline", "default", "")
+		fromEnv := flag.String("fromenv", "default", "")
+		removed := flag.StringSlice("removed", []string{"default"}, "")
+		added := flag.Int("added", 1, "")
+		files := fstest.MapFS{
+			"start.toml": {Data: []byte(`fromconfig = "config"
+fromcmdline = "config"
+fromenv = "config"
+removed = ["a", "b"]`)},
+		}
+		SetFileSystem(files)
+		SetEnvLookup(mapEnv(map[string]string{"START_FROMENV": "env"}))
+		os.Args = []string{os.Args[0], "--fromcmdline=cmdline"}
+		So(Reparse(), ShouldBeNil)
+		So(*removed, ShouldResemble, []string{"a", "b"})
+
+		var changed []string
+		OnConfigChange(func(c []string) { changed = c })
+
+		Convey("a reload should only update flags that the config file has set", func() {
+			files["start.toml"] = &fstest.MapFile{Data: []byte(`fromconfig = "new config"
+fromcmdline = "new config"
+fromenv = "new config"
+added = 2`)}
+			So(reloadConfig(), ShouldBeNil)
+			So(*fromConfig, ShouldEqual, "new config")
+			So(*fromCmdline, ShouldEqual, "cmdline")
+			So(*fromEnv, ShouldEqual, "env")
+			So(*added, ShouldEqual, 2)
+
+			Convey("and reset removed keys to their defaults", func() {
+				So(*removed, ShouldResemble, []string{"default"})
+				So(FlagSource("removed"), ShouldEqual, "default")
+				So(flag.Lookup("removed").DefValue, ShouldEqual, "[default]")
+				So(flag.Lookup("fromconfig").DefValue, ShouldEqual, "new config")
+				So(changed, ShouldResemble, []string{"added", "fromconfig", "removed"})
+			})
+		})
+
+		Convey("a change function should be able to call DecodeConfig", func() {
+			var decoded struct {
+				FromConfig string `toml:"fromconfig"`
+			}
+			done := make(chan error, 1)
+			OnConfigChange(func(c []string) { done <- DecodeConfig("", &decoded) })
+			files["start.toml"] = &fstest.MapFile{Data: []byte(`fromconfig = "new config"`)}
+			go reloadConfig()
+			select {
+			case err := <-done:
+				So(err, ShouldBeNil)
+				So(decoded.FromConfig, ShouldEqual, "new config")
+			case <-time.After(5 * time.Second):
+				t.Fatal("DecodeConfig in a change function deadlocks")
+			}
+		})
+
+		Convey("a reload without changes should not call the change functions", func() {
+			So(reloadConfig(), ShouldBeNil)
+			So(changed, ShouldBeNil)
+		})
+
+		Convey("a reload should remove keys of map flags that the config file no longer contains", func() {
+			labels := flag.StringToString("labels", nil, "")
+			files["start.toml"] = &fstest.MapFile{Data: []byte(`labels = {a = "1", b = "2"}`)}
+			So(Reparse(), ShouldBeNil)
+			So(*labels, ShouldResemble, map[string]string{"a": "1", "b": "2"})
+			files["start.toml"] = &fstest.MapFile{Data: []byte(`labels = {b = "3"}`)}
+			So(reloadConfig(), ShouldBeNil)
+			So(*labels, ShouldResemble, map[string]string{"b": "3"})
+			files["start.toml"] = &fstest.MapFile{Data: []byte(``)}
+			So(reloadConfig(), ShouldBeNil)
+			So(*labels, ShouldBeEmpty)
+		})
+
+		Convey("an invalid config file should leave all values unchanged", func() {
+			files["start.toml"] = &fstest.MapFile{Data: []byte(`fromconfig = "new config"
+added = "two"`)}
+			So(reloadConfig(), ShouldNotBeNil)
+			So(*fromConfig, ShouldEqual, "config")
+			So(*added, ShouldEqual, 1)
+			So(*removed, ShouldResemble, []string{"a", "b"})
+			So(changed, ShouldBeNil)
+		})
+
+		Convey("a config file that violates a rule should leave all values unchanged", func() {
+			Require("fromconfig")
+			files["start.toml"] = &fstest.MapFile{Data: []byte(`added = 2`)}
+			So(reloadConfig(), ShouldNotBeNil)
+			So(*fromConfig, ShouldEqual, "config")
+			So(*added, ShouldEqual, 1)
+		})
+
+		Reset(func() {
+			configChangeFuncs = nil
+			constraints = nil
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+		})
+	})
+}
+
+func TestPollFiles(t *testing.T) {
+	Convey("pollFiles should notice changes of a file", t, func() {
+		path := filepath.Join(t.TempDir(), "start.toml")
+		So(os.WriteFile(path, []byte(`a = 1`), 0o600), ShouldBeNil)
+		pollInterval = 10 * time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		notified := make(chan struct{}, 1)
+		done := make(chan struct{})
+		go func() {
+			pollFiles(ctx, []string{path}, func() { notified <- struct{}{} })
+			close(done)
+		}()
+		time.Sleep(30 * time.Millisecond)
+		So(os.WriteFile(path, []byte(`a = 12`), 0o600), ShouldBeNil)
+
+		select {
+		case <-notified:
+		case <-time.After(5 * time.Second):
+			So("no notification", ShouldBeEmpty)
+		}
+		cancel()
+		<-done
+		pollInterval = defaultPollInterval
+	})
+}
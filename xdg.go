@@ -0,0 +1,148 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// The functions in this file implement the XDG Base Directory Specification
+// (https://specifications.freedesktop.org/basedir-spec/latest/) for
+// Unix-like operating systems. On Windows, they use %LOCALAPPDATA% and
+// %PROGRAMDATA% instead.
+// All returned directories are app-specific; that is, they end in the app name.
+
+// Dirs contains the app-specific directories for config files, data files,
+// cache files, and state files (like history or log files), as well as the
+// system-wide config directories. See AppDirs().
+type Dirs struct {
+	Config       string
+	Data         string
+	Cache        string
+	State        string
+	SystemConfig []string
+}
+
+// AppDirs returns all app-specific directories. The directories may not exist.
+func AppDirs() Dirs {
+	var d Dirs
+	d.Config, _ = GetUserConfigDir()
+	d.Data, _ = GetUserDataDir()
+	d.Cache, _ = GetUserCacheDir()
+	d.State, _ = GetUserStateDir()
+	d.SystemConfig = GetSystemConfigDirs()
+	return d
+}
+
+// GetUserConfigDir finds the user's config directory in an OS-independent way.
+// "OS-independent" means compatible with most Unix-like operating systems as well as with Microsoft Windows(TM).
+// The boolean return value indicates if the directory exists at the location determined
+// via environment variables.
+// On Unix-like systems, the directory is $XDG_CONFIG_HOME/<appname>, or
+// ~/.config/<appname> if $XDG_CONFIG_HOME is not set. On Windows,
+// the directory is %LOCALAPPDATA%\<appname>.
+func GetUserConfigDir() (dir string, exists bool) {
+	// Credits for this OS-independent solution go to Stackoverflow user peterSO
+	// (see http://stackoverflow.com/a/7922977). I just modified it a bit to
+	// get the respective config dir instead of the home dir.
+	// Using os.User is not an option here. It relies on CGO and thus prevents
+	// cross compiling.
+	if runtime.GOOS == "windows" {
+		dir = filepath.Join(getenv("LOCALAPPDATA"), appName())
+	} else {
+		dir = xdgDir("XDG_CONFIG_HOME", ".config")
+	}
+	return dir, dirExists(dir)
+}
+
+// GetUserDataDir returns the user's data directory for the application:
+// $XDG_DATA_HOME/<appname>, or ~/.local/share/<appname> if $XDG_DATA_HOME
+// is not set. On Windows, it is %LOCALAPPDATA%\<appname>\data.
+// The boolean return value indicates if the directory exists.
+func GetUserDataDir() (dir string, exists bool) {
+	if runtime.GOOS == "windows" {
+		dir = filepath.Join(getenv("LOCALAPPDATA"), appName(), "data")
+	} else {
+		dir = xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+	}
+	return dir, dirExists(dir)
+}
+
+// GetUserCacheDir returns the user's cache directory for the application:
+// $XDG_CACHE_HOME/<appname>, or ~/.cache/<appname> if $XDG_CACHE_HOME
+// is not set. On Windows, it is %LOCALAPPDATA%\<appname>\cache.
+// The boolean return value indicates if the directory exists.
+func GetUserCacheDir() (dir string, exists bool) {
+	if runtime.GOOS == "windows" {
+		dir = filepath.Join(getenv("LOCALAPPDATA"), appName(), "cache")
+	} else {
+		dir = xdgDir("XDG_CACHE_HOME", ".cache")
+	}
+	return dir, dirExists(dir)
+}
+
+// GetUserStateDir returns the user's state directory for the application,
+// for data that should persist between runs but is not important enough
+// for the data dir (history, logs, recently used files):
+// $XDG_STATE_HOME/<appname>, or ~/.local/state/<appname> if $XDG_STATE_HOME
+// is not set. On Windows, it is %LOCALAPPDATA%\<appname>\state.
+// The boolean return value indicates if the directory exists.
+func GetUserStateDir() (dir string, exists bool) {
+	if runtime.GOOS == "windows" {
+		dir = filepath.Join(getenv("LOCALAPPDATA"), appName(), "state")
+	} else {
+		dir = xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+	}
+	return dir, dirExists(dir)
+}
+
+// GetSystemConfigDirs returns the system-wide config directories for the
+// application, in order of precedence: each directory of $XDG_CONFIG_DIRS
+// with <appname> appended, or /etc/xdg/<appname> if $XDG_CONFIG_DIRS is not
+// set. On Windows, it returns %PROGRAMDATA%\<appname>.
+// The directories may not exist.
+func GetSystemConfigDirs() []string {
+	if runtime.GOOS == "windows" {
+		programData := getenv("PROGRAMDATA")
+		if programData == "" {
+			return nil
+		}
+		return []string{filepath.Join(programData, appName())}
+	}
+	var dirs []string
+	for _, dir := range filepath.SplitList(getenv("XDG_CONFIG_DIRS")) {
+		// The spec requires ignoring relative paths.
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, filepath.Join(dir, appName()))
+		}
+	}
+	if len(dirs) == 0 {
+		dirs = []string{filepath.Join(string(filepath.Separator), "etc", "xdg", appName())}
+	}
+	return dirs
+}
+
+// xdgDir returns the app-specific subdirectory of the directory in the
+// environment variable envVar, or of $HOME/homeSubdir if envVar is not
+// set or does not contain an absolute path.
+func xdgDir(envVar, homeSubdir string) string {
+	dir := getenv(envVar)
+	if !filepath.IsAbs(dir) {
+		// The spec requires ignoring relative paths.
+		dir = filepath.Join(getenv("HOME"), homeSubdir)
+	}
+	return filepath.Join(dir, appName())
+}
+
+// dirExists returns false if dir does not exist in the file system.
+func dirExists(dir string) bool {
+	_, err := statFile(dir)
+	return !os.IsNotExist(err)
+}
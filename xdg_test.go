@@ -0,0 +1,112 @@
+// Copyright (c) Christoph Berger. All rights reserved.
+// Use of this source code is governed by the BSD (3-Clause)
+// License that can be found in the LICENSE.txt file.
+//
+// This source code may import third-party source code whose
+// licenses are provided in the respective license files.
+
+package start
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestXDGDirs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("XDG directories do not apply to Windows")
+	}
+
+	Convey("Given no XDG environment variables", t, func() {
+		SetEnvLookup(mapEnv(map[string]string{"HOME": "/home/u"}))
+
+		Convey("the directories should default to the locations in $HOME", func() {
+			d := AppDirs()
+			So(d.Config, ShouldEqual, "/home/u/.config/start")
+			So(d.Data, ShouldEqual, "/home/u/.local/share/start")
+			So(d.Cache, ShouldEqual, "/home/u/.cache/start")
+			So(d.State, ShouldEqual, "/home/u/.local/state/start")
+			So(d.SystemConfig, ShouldResemble, []string{"/etc/xdg/start"})
+		})
+
+		Reset(func() {
+			SetEnvLookup(nil)
+		})
+	})
+
+	Convey("Given XDG environment variables", t, func() {
+		SetEnvLookup(mapEnv(map[string]string{
+			"HOME":            "/home/u",
+			"XDG_CONFIG_HOME": "/xdg/config",
+			"XDG_DATA_HOME":   "/xdg/data",
+			"XDG_CACHE_HOME":  "relative/cache",
+			"XDG_STATE_HOME":  "/xdg/state",
+			"XDG_CONFIG_DIRS": "/etc/one:relative:/etc/two",
+		}))
+
+		Convey("the directories should be app-specific subdirs of the XDG directories", func() {
+			d := AppDirs()
+			So(d.Config, ShouldEqual, "/xdg/config/start")
+			So(d.Data, ShouldEqual, "/xdg/data/start")
+			So(d.State, ShouldEqual, "/xdg/state/start")
+			So(d.SystemConfig, ShouldResemble, []string{"/etc/one/start", "/etc/two/start"})
+		})
+
+		Convey("relative paths should be ignored", func() {
+			So(AppDirs().Cache, ShouldEqual, "/home/u/.cache/start")
+		})
+
+		Reset(func() {
+			SetEnvLookup(nil)
+		})
+	})
+}
+
+func TestLayeredConfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("XDG directories do not apply to Windows")
+	}
+
+	Convey("Given config files in the user config dir and in the system config dirs", t, func() {
+		SetFileSystem(fstest.MapFS{
+			"home/u/.config/start/config.toml": {Data: []byte("user = \"user\"\nshared = \"user\"")},
+			"etc/one/start/config.toml":        {Data: []byte("one = \"one\"\nshared = \"one\"\nsystem = \"one\"")},
+			"etc/two/start/config.toml":        {Data: []byte("two = \"two\"\nsystem = \"two\"")},
+		})
+		SetEnvLookup(mapEnv(map[string]string{
+			"HOME":            "/home/u",
+			"XDG_CONFIG_DIRS": "/etc/one:/etc/two",
+		}))
+		cfg, err := newConfigFile("")
+		So(err, ShouldBeNil)
+
+		Convey("the user's config file should take precedence over the system config files", func() {
+			So(cfg.String("shared"), ShouldEqual, "user")
+			So(cfg.String("system"), ShouldEqual, "one")
+		})
+
+		Convey("values missing in the user's config file should come from the system config files", func() {
+			So(cfg.String("user"), ShouldEqual, "user")
+			So(cfg.String("one"), ShouldEqual, "one")
+			So(cfg.String("two"), ShouldEqual, "two")
+		})
+
+		Convey("all files should be reported in order of precedence", func() {
+			So(cfg.Paths(), ShouldResemble, []string{
+				filepath.FromSlash("/home/u/.config/start/config.toml"),
+				filepath.FromSlash("/etc/one/start/config.toml"),
+				filepath.FromSlash("/etc/two/start/config.toml"),
+			})
+			So(cfg.Path(), ShouldEqual, "/home/u/.config/start/config.toml")
+		})
+
+		Reset(func() {
+			SetFileSystem(nil)
+			SetEnvLookup(nil)
+		})
+	})
+}